@@ -0,0 +1,70 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ConnAffinity 决定各分片是否共用连接，主要影响 HTTP/2。
+type ConnAffinity int
+
+const (
+	// ConnShared 所有分片共用一个连接池(默认)。HTTP/2 下通常只有一条连接，所有分片在其上多路复用，
+	// 握手开销最小，但所有分片共享这条连接的流控窗口与 TCP 拥塞窗口。
+	ConnShared ConnAffinity = iota
+	// ConnPerPart 每个分片使用独立的连接池，HTTP/2 下会建立与分片数相同的连接。
+	// 多出每条连接的握手开销，但单条连接吞吐受限(流控窗口小、丢包)时更快。
+	ConnPerPart
+)
+
+func (a ConnAffinity) String() string {
+	switch a {
+	case ConnShared:
+		return "shared"
+	case ConnPerPart:
+		return "per-part"
+	}
+	return fmt.Sprintf("ConnAffinity(%d)", int(a))
+}
+
+// partClients 在 ConnPerPart 时为 n 个分片各生成一个使用独立 Transport 的 client，
+// 限制了同时下载的分片数时只生成该数量的 client，由先后下载的分片轮流使用。其余配置与 o.client 相同。ConnShared 或 Transport 无法复制时返回 nil，所有分片使用 o.client。
+func (o *options) partClients(n int64) []*http.Client {
+	if o.concurrency > 0 && int64(o.concurrency) < n {
+		n = int64(o.concurrency)
+	}
+	if o.connAffinity != ConnPerPart || n <= 1 {
+		return nil
+	}
+	base := o.client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		o.logger.Warn("transport can not be cloned, parts share connections", "transport", fmt.Sprintf("%T", base))
+		return nil
+	}
+	clients := make([]*http.Client, n)
+	for i := range clients {
+		c := *o.client
+		c.Transport = transport.Clone()
+		clients[i] = &c
+	}
+	return clients
+}
+
+// closePartClients 关闭 partClients 生成的连接。
+func closePartClients(clients []*http.Client) {
+	for _, c := range clients {
+		c.CloseIdleConnections()
+	}
+}
+
+// clientFor 返回第 part_num 个分片使用的 client。
+func (w *worker) clientFor(part_num int64) *http.Client {
+	if len(w.clients) == 0 {
+		return w.opts.client
+	}
+	return w.clients[part_num%int64(len(w.clients))]
+}
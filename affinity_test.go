@@ -0,0 +1,83 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newH2Server 启动 HTTP/2(TLS)测试服务器，conns 记录分片请求来自的不同连接。
+func newH2Server(tb testing.TB, data []byte) (s *httptest.Server, conns func() int) {
+	var mu sync.Mutex
+	remotes := map[string]bool{}
+	s = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			remotes[r.RemoteAddr] = true
+			mu.Unlock()
+		}
+		serveData(data)(w, r)
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	tb.Cleanup(s.Close)
+	return s, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := len(remotes)
+		for k := range remotes {
+			delete(remotes, k)
+		}
+		return n
+	}
+}
+
+func TestConnAffinityHTTP2(t *testing.T) {
+	data := testContent(1 << 20)
+	s, conns := newH2Server(t, data)
+	tests := []struct {
+		affinity ConnAffinity
+		conns    int
+	}{
+		{ConnShared, 1},
+		{ConnPerPart, 8},
+	}
+	for _, tt := range tests {
+		res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 8,
+			WithHTTPClient(s.Client()), WithConnAffinity(tt.affinity))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.affinity, err)
+		}
+		checkFile(t, res.Path, data)
+		if n := conns(); n != tt.conns {
+			t.Errorf("%s: parts used %d connections, want %d", tt.affinity, n, tt.conns)
+		}
+		s.Client().CloseIdleConnections()
+	}
+}
+
+// BenchmarkConnAffinityHTTP2 比较 HTTP/2 下所有分片共用一条连接与每个分片一条连接的吞吐，
+// 每次下载都重新建立连接，计入握手开销。
+func BenchmarkConnAffinityHTTP2(b *testing.B) {
+	data := testContent(64 << 20)
+	s, _ := newH2Server(b, data)
+	for _, affinity := range []ConnAffinity{ConnShared, ConnPerPart} {
+		b.Run(fmt.Sprint(affinity), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_, err := ParallelFetch(s.URL+"/f.bin", 8, func(int64, []byte) error { return nil },
+					WithHTTPClient(s.Client()), WithConnAffinity(affinity))
+				if err != nil {
+					b.Fatal(err)
+				}
+				s.Client().CloseIdleConnections()
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package paralleldownload
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditRecord 为审计日志中的一条记录，对应一个分片的下载结果。
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	URL    string    `json:"url"`
+	Part   int64     `json:"part"`
+	Start  int64     `json:"start"`
+	End    int64     `json:"end"`
+	Status string    `json:"status"`
+	Bytes  int64     `json:"bytes"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// auditLog 将记录放入队列，由后台 goroutine 顺序写出，写入慢时不影响下载。
+type auditLog struct {
+	mu     sync.Mutex
+	queue  []AuditRecord
+	closed bool
+	notify chan struct{}
+	done   chan struct{}
+}
+
+func newAuditLog(w io.Writer) *auditLog {
+	a := &auditLog{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go a.run(json.NewEncoder(w))
+	return a
+}
+
+func (a *auditLog) run(enc *json.Encoder) {
+	defer close(a.done)
+	for {
+		a.mu.Lock()
+		queue, closed := a.queue, a.closed
+		a.queue = nil
+		a.mu.Unlock()
+		for _, r := range queue {
+			// 审计日志写入失败不影响下载
+			_ = enc.Encode(r)
+		}
+		if closed {
+			return
+		}
+		<-a.notify
+	}
+}
+
+func (a *auditLog) record(url string, p part, written int64, err error) {
+	if a == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:   time.Now(),
+		URL:    url,
+		Part:   p.num,
+		Start:  p.start,
+		End:    p.end,
+		Status: "ok",
+		Bytes:  written,
+	}
+	if err != nil {
+		r.Status = "failed"
+		r.Error = err.Error()
+	}
+	a.mu.Lock()
+	a.queue = append(a.queue, r)
+	a.mu.Unlock()
+	a.wake()
+}
+
+// close 等待所有记录写完。
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	a.wake()
+	<-a.done
+}
+
+func (a *auditLog) wake() {
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
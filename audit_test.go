@@ -0,0 +1,72 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readAudit 解析审计日志，按分片编号排序。
+func readAudit(t *testing.T, buf *bytes.Buffer) []AuditRecord {
+	t.Helper()
+	var records []AuditRecord
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var r AuditRecord
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Part < records[j].Part })
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	data := testContent(4000)
+	s := newServer(t, serveData(data))
+	var buf bytes.Buffer
+	if err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 4, WithAuditLog(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	records := readAudit(t, &buf)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want one per part", len(records))
+	}
+	for i, r := range records {
+		start := int64(i) * 1000
+		if r.Part != int64(i) || r.Start != start || r.End != start+999 || r.Bytes != 1000 ||
+			r.Status != "ok" || r.URL != s.URL+"/f.bin" || r.Time.IsZero() || r.Error != "" {
+			t.Errorf("record %d = %+v", i, r)
+		}
+	}
+}
+
+func TestAuditLogFailedPart(t *testing.T) {
+	data := testContent(4000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=2000-2999" {
+			http.Error(w, "boom", http.StatusNotFound)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	var buf bytes.Buffer
+	if err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 4, WithAuditLog(&buf)); err == nil {
+		t.Fatal("download succeeded although a part failed")
+	}
+	var failed []AuditRecord
+	for _, r := range readAudit(t, &buf) {
+		// 其他分片可能在出错后被取消
+		if r.Status == "failed" && !strings.Contains(r.Error, context.Canceled.Error()) {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) != 1 || failed[0].Part != 2 || failed[0].Bytes != 0 || failed[0].Error == "" {
+		t.Fatalf("failed records = %+v", failed)
+	}
+}
@@ -0,0 +1,29 @@
+package paralleldownload
+
+import (
+	"io"
+	"sync"
+)
+
+// defaultBufferSize 为各分片读取响应体的默认缓冲区大小。本机回环 8 线程获取 256 MiB 时，
+// 4 KiB 约 1.2 GB/s，32 KiB 约 2.2 GB/s，更大的缓冲区只再提升约一成(见 README 与 BenchmarkParallelFetchBufferSize)。
+const defaultBufferSize = 32 << 10
+
+// newBufferPool 返回缓冲区大小为 size 的池，分片结束后归还缓冲区供后开始的分片复用，
+// 分片数多于同时下载的数量时不必为每个分片分配缓冲区。
+func newBufferPool(size int) *sync.Pool {
+	return &sync.Pool{New: func() any {
+		buf := make([]byte, size)
+		return &buf
+	}}
+}
+
+// fillBuffer 读取 r 直到 buf 填满或读完，r 结束时返回 io.EOF。
+// 网络上的一次 Read 常常只返回几 KiB，合并后每个缓冲区只调用一次 WriteAt 及各回调。
+func fillBuffer(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
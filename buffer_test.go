@@ -0,0 +1,148 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// BenchmarkParallelFetchBufferSize 对应 README 与 defaultBufferSize 注释中的表格：
+// 本机回环 8 线程获取 256 MiB，不写磁盘。
+func BenchmarkParallelFetchBufferSize(b *testing.B) {
+	data := testContent(256 << 20)
+	s := httptest.NewServer(serveData(data))
+	defer s.Close()
+	for _, size := range []int{4 << 10, 16 << 10, 32 << 10, 64 << 10, 256 << 10} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				_, err := ParallelFetch(s.URL+"/f.bin", 8, func(int64, []byte) error { return nil }, WithBufferSize(size))
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// byteServer 以每次 1 字节的写入提供 data 的 Range 请求，slow 为 true 的分片每 64 字节暂停 1ms。
+func byteServer(t *testing.T, data []byte, slow func(start int) bool) *httptest.Server {
+	return newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil || r.Method != http.MethodGet {
+			serveData(data)(w, r)
+			return
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		for i := start; i <= end; i++ {
+			if _, err := w.Write(data[i : i+1]); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			if slow(start) && i%64 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}))
+}
+
+// recordingWriterAt 保存写入的数据并记录每次 WriteAt 的偏移与长度。
+type recordingWriterAt struct {
+	mu     sync.Mutex
+	data   []byte
+	writes []Range
+}
+
+func (w *recordingWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	copy(w.data[off:], p)
+	w.writes = append(w.writes, Range{Start: off, End: off + int64(len(p)) - 1})
+	return len(p), nil
+}
+
+func TestBufferCoalescesShortReads(t *testing.T) {
+	data := testContent(64 << 10)
+	s := byteServer(t, data, func(int) bool { return false })
+	dst := &recordingWriterAt{data: make([]byte, len(data))}
+	const bufferSize = 4 << 10
+	if _, err := ParallelDownloadToWriterAt(s.URL+"/f.bin", dst, 4, WithBufferSize(bufferSize)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.data, data) {
+		t.Fatal("content mismatch")
+	}
+	// 每个分片 16 KiB，1 字节的读取合并为 4 次满缓冲区的写入
+	if n := len(dst.writes); n != len(data)/bufferSize {
+		t.Fatalf("%d WriteAt calls, want %d", n, len(data)/bufferSize)
+	}
+	for _, w := range dst.writes {
+		if w.End-w.Start+1 != bufferSize {
+			t.Fatalf("short write %+v", w)
+		}
+	}
+}
+
+func TestBufferTruncatedBySteal(t *testing.T) {
+	data := testContent(64 << 10)
+	// 第一个分片很慢，其他线程结束后拆分它的后半部分
+	s := byteServer(t, data, func(start int) bool { return start == 0 })
+	const partSize = 16 << 10
+	dst := &recordingWriterAt{data: make([]byte, len(data))}
+	seen := make([]int32, len(data))
+	var mu sync.Mutex
+	var tee bytes.Buffer
+	logger := &recordLogger{}
+	_, err := ParallelDownloadToWriterAt(s.URL+"/f.bin", dst, 4,
+		// 缓冲区与分片一样大，慢分片读完之前不会写入，拆分一定落在缓冲区中间
+		WithBufferSize(partSize), WithWorkStealing(1<<10), WithLogger(logger),
+		WithDataCallback(func(offset int64, p []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			for i := range p {
+				seen[offset+int64(i)]++
+			}
+			return nil
+		}),
+		WithTee(&tee),
+		WithPieceChecksums("sha256", 1<<10, pieceSums(data, 1<<10)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logger.find("split slow part"); !ok {
+		t.Fatal("slow part was not split")
+	}
+	if !bytes.Equal(dst.data, data) || !bytes.Equal(tee.Bytes(), data) {
+		t.Fatal("content mismatch")
+	}
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("data callback saw offset %d %d times", i, n)
+		}
+	}
+	// 慢分片只写入拆分处之前的部分，所有写入不重叠
+	var total int64
+	truncated := false
+	for _, w := range dst.writes {
+		total += w.End - w.Start + 1
+		if w.Start == 0 {
+			truncated = w.End < partSize-1
+		}
+	}
+	if !truncated {
+		t.Fatal("slow part wrote past the split")
+	}
+	if total != int64(len(data)) {
+		t.Fatalf("wrote %d bytes in total, want %d", total, len(data))
+	}
+}
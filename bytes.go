@@ -0,0 +1,98 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// defaultMaxBytes 为未设置 WithMaxSize 时 DownloadBytes 允许的最大字节数。
+const defaultMaxBytes = 256 << 20
+
+// DownloadBytes 多线程下载 url 并返回其内容，不写入文件，参见 Downloader.DownloadBytes。
+func DownloadBytes(ctx context.Context, download_url string, opts ...Option) ([]byte, error) {
+	return (&Downloader{}).DownloadBytes(ctx, download_url, opts...)
+}
+
+// DownloadBytes 多线程下载 url 并返回其内容，不写入文件。获取到文件大小后一次分配好切片，各分片直接写入，
+// 服务器不支持 Range 时顺序读取。文件超过 WithMaxSize(默认 256 MiB)时返回 ErrTooLarge，
+// 线程数由 WithWorkers 设置，设置了 WithChecksums 时校验通过才返回。
+func (d *Downloader) DownloadBytes(ctx context.Context, download_url string, opts ...Option) ([]byte, error) {
+	o := d.options(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.maxSize == 0 {
+		o.maxSize = defaultMaxBytes
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	store := &bytesStore{max: o.maxSize}
+	err := canceledError(ctx, parallelTo(dctx, download_url, store, 0, o))
+	if err == nil && len(o.checksums) > 0 {
+		err = verifyChecksums(bytes.NewReader(store.buf), o.checksums)
+	}
+	o.finish(download_url, err)
+	if err != nil {
+		return nil, err
+	}
+	return store.buf, nil
+}
+
+// sizedStore 为需要在下载前知道文件大小的 PartStore，多线程下载开始前调用 allocate。
+type sizedStore interface {
+	allocate(size int64) error
+}
+
+// bytesStore 将数据写入内存。多线程下载时按文件大小预先分配，各分片并发写入不同的位置；
+// 单线程下载时随顺序写入扩展，不超过 max。
+type bytesStore struct {
+	max int64
+	mu  sync.RWMutex
+	buf []byte
+}
+
+func (s *bytesStore) allocate(size int64) error {
+	if size > s.max {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, size, s.max)
+	}
+	s.buf = make([]byte, size)
+	return nil
+}
+
+func (s *bytesStore) WriteAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	s.mu.RLock()
+	if end <= int64(len(s.buf)) {
+		copy(s.buf[off:], p)
+		s.mu.RUnlock()
+		return len(p), nil
+	}
+	s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if end > s.max {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, s.max)
+	}
+	if end > int64(cap(s.buf)) {
+		size := 2 * int64(cap(s.buf))
+		if size < end {
+			size = end
+		}
+		if size > s.max {
+			size = s.max
+		}
+		buf := make([]byte, len(s.buf), size)
+		copy(buf, s.buf)
+		s.buf = buf
+	}
+	s.buf = s.buf[:end]
+	copy(s.buf[off:], p)
+	return len(p), nil
+}
+
+func (s *bytesStore) Finalize() error { return nil }
+
+func (s *bytesStore) CompletedRanges() []Range { return nil }
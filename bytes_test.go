@@ -0,0 +1,89 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// chunkedServer 不支持 Range，也不返回 Content-Length，只能顺序读取且大小未知。
+func chunkedServer(t *testing.T, data []byte) string {
+	t.Helper()
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			return
+		}
+		for i := 0; i < len(data); i += 1000 {
+			end := i + 1000
+			if end > len(data) {
+				end = len(data)
+			}
+			w.Write(data[i:end])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	return s.URL + "/f.bin"
+}
+
+func TestDownloadBytes(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	got, err := DownloadBytes(context.Background(), s.URL+"/f.bin", WithWorkers(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch, got %d bytes", len(got))
+	}
+
+	got, err = DownloadBytes(context.Background(), chunkedServer(t, data), WithMaxSize(int64(len(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("unknown size: content mismatch, got %d bytes", len(got))
+	}
+}
+
+func TestDownloadBytesTooLarge(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	// 大小已知时在分配之前拒绝
+	if _, err := DownloadBytes(context.Background(), s.URL+"/f.bin", WithMaxSize(10000)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("known size: err = %v, want ErrTooLarge", err)
+	}
+	// 大小未知时在顺序写入超过限制时停止
+	if _, err := DownloadBytes(context.Background(), chunkedServer(t, data), WithMaxSize(10000)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("unknown size: err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestBytesStoreLimit(t *testing.T) {
+	s := &bytesStore{max: 100}
+	if err := s.allocate(101); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("allocate: err = %v, want ErrTooLarge", err)
+	}
+	if err := s.allocate(50); err != nil || len(s.buf) != 50 {
+		t.Fatalf("allocate: %d bytes, err %v", len(s.buf), err)
+	}
+
+	// 未分配时随写入扩展，容量不超过 max
+	s = &bytesStore{max: 100}
+	chunk := bytes.Repeat([]byte{'x'}, 30)
+	for off := int64(0); off < 90; off += 30 {
+		if n, err := s.WriteAt(chunk, off); n != len(chunk) || err != nil {
+			t.Fatalf("WriteAt(%d) = %d, %v", off, n, err)
+		}
+	}
+	if len(s.buf) != 90 || cap(s.buf) > 100 {
+		t.Fatalf("len = %d, cap = %d", len(s.buf), cap(s.buf))
+	}
+	if _, err := s.WriteAt(chunk, 90); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("write past max: err = %v, want ErrTooLarge", err)
+	}
+	if n, err := s.WriteAt(chunk[:10], 90); n != 10 || err != nil || len(s.buf) != 100 {
+		t.Fatalf("write up to max: n = %d, len = %d, err %v", n, len(s.buf), err)
+	}
+}
@@ -0,0 +1,183 @@
+package paralleldownload
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrChecksumMismatch 表示下载文件的摘要与 WithChecksums 提供的不一致。
+var ErrChecksumMismatch = errors.New("checksum not match")
+
+// ChecksumError 为整个文件校验失败时返回的错误，errors.Is(err, ErrChecksumMismatch) 为 true。
+// 设置了多种算法时为按算法名排序后第一个不一致的算法。
+type ChecksumError struct {
+	Algo     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: %s: expected %s, actual %s", ErrChecksumMismatch, e.Algo, e.Expected, e.Actual)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+var hashFuncs = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func newHash(algo string) (hash.Hash, error) {
+	newFunc, ok := hashFuncs[strings.ToLower(algo)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+	return newFunc(), nil
+}
+
+// removeCorrupt 删除未通过校验的文件，设置了 WithKeepCorrupt 时保留。
+func removeCorrupt(path string, err error, o *options) {
+	if o.keepCorrupt {
+		o.logger.Warn("keep file failed checksum", "path", path, "err", err)
+		return
+	}
+	o.logger.Warn("remove file failed checksum", "path", path, "err", err)
+	if rerr := o.fsys().Remove(path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+		o.logger.Warn("remove file failed", "path", path, "err", rerr)
+	}
+}
+
+// removeIncomplete 删除下载失败、内容不完整的文件，避免被误认为下载成功。
+func removeIncomplete(path string, err error, o *options) {
+	o.logger.Warn("remove incomplete file", "path", path, "err", err)
+	if rerr := o.fsys().Remove(path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+		o.logger.Warn("remove file failed", "path", path, "err", rerr)
+	}
+}
+
+// verifyChecksums 读取一遍 r，同时计算 sums 中的所有摘要并比较，任一不一致即返回错误。
+func verifyChecksums(r io.Reader, sums map[string]string) error {
+	cw, err := newChecksumWriter(sums)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(cw, r); err != nil {
+		return fmt.Errorf("checksum read error: %w", err)
+	}
+	return cw.verify()
+}
+
+// checksumWriter 对写入的数据同时计算 sums 中的所有摘要，用于无法重新读取的顺序下载。
+type checksumWriter struct {
+	algos  []string
+	hashes []hash.Hash
+	sums   map[string]string
+}
+
+func newChecksumWriter(sums map[string]string) (*checksumWriter, error) {
+	cw := &checksumWriter{sums: sums}
+	for algo := range sums {
+		cw.algos = append(cw.algos, algo)
+	}
+	sort.Strings(cw.algos)
+	for _, algo := range cw.algos {
+		h, err := newHash(algo)
+		if err != nil {
+			return nil, err
+		}
+		cw.hashes = append(cw.hashes, h)
+	}
+	return cw, nil
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	for _, h := range cw.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify 比较已写入数据的摘要，返回第一个不一致的算法的 ChecksumError。
+func (cw *checksumWriter) verify() error {
+	for i, algo := range cw.algos {
+		actual := hex.EncodeToString(cw.hashes[i].Sum(nil))
+		if expected := strings.TrimSpace(cw.sums[algo]); !strings.EqualFold(actual, expected) {
+			return &ChecksumError{Algo: algo, Expected: expected, Actual: actual}
+		}
+	}
+	return nil
+}
+
+// ParseChecksumManifest 解析 sha256sum 等工具输出的摘要清单，返回文件名到十六进制摘要的映射，
+// 用于 WithChecksumManifest。支持 GNU 格式("<摘要>  <文件名>"，二进制模式为 "<摘要> *<文件名>")
+// 与 BSD 格式("SHA256 (<文件名>) = <摘要>")，忽略空行与 # 开头的注释。
+func ParseChecksumManifest(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var name, sum string
+		if i := strings.Index(text, " ("); i > 0 && strings.Contains(text, ") = ") {
+			j := strings.LastIndex(text, ") = ")
+			name, sum = text[i+2:j], text[j+4:]
+		} else if fields := strings.SplitN(text, " ", 2); len(fields) == 2 {
+			sum, name = fields[0], strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		}
+		name = strings.TrimPrefix(name, "./")
+		if _, err := hex.DecodeString(sum); err != nil || sum == "" || name == "" {
+			return nil, fmt.Errorf("invalid checksum manifest line %d: %q", line, text)
+		}
+		sums[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// manifestChecksum 按文件名 name 从 WithChecksumManifest 的清单中查找摘要并加入需要校验的摘要，
+// 清单中的文件名可以带目录，只比较最后一段。
+func (o *options) manifestChecksum(name string) error {
+	if o.manifest == nil {
+		return nil
+	}
+	sum, ok := o.manifest[name]
+	if !ok {
+		for k, v := range o.manifest {
+			if path.Base(k) == name {
+				sum, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%s is not listed in the checksum manifest", name)
+	}
+	checksums := map[string]string{o.manifestAlgo: sum}
+	for algo, s := range o.checksums {
+		checksums[algo] = s
+	}
+	o.checksums = checksums
+	return nil
+}
@@ -0,0 +1,54 @@
+package paralleldownload
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func hexSum(sum []byte) string {
+	return hex.EncodeToString(sum)
+}
+
+func TestChecksumsMultipleAlgorithms(t *testing.T) {
+	data := testContent(30000)
+	s := newServer(t, serveData(data))
+	md5Sum := md5.Sum(data)
+	sha1Sum := sha1.Sum(data)
+	sha256Sum := sha256.Sum256(data)
+	sums := map[string]string{
+		"md5":    hexSum(md5Sum[:]),
+		"sha1":   hexSum(sha1Sum[:]),
+		"SHA256": hexSum(sha256Sum[:]),
+	}
+
+	dir := t.TempDir()
+	if err := ParallelDownload(s.URL+"/f.bin", dir, "ok.bin", 4, WithChecksums(sums)); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "ok.bin"), data)
+
+	// 只有 sha1 不一致
+	sums["sha1"] = hexSum(make([]byte, sha1.Size))
+	err := ParallelDownload(s.URL+"/f.bin", dir, "bad.bin", 4, WithChecksums(sums))
+	var ce *ChecksumError
+	if !errors.As(err, &ce) || !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want *ChecksumError", err)
+	}
+	if ce.Algo != "sha1" || ce.Actual != hexSum(sha1Sum[:]) {
+		t.Fatalf("mismatch reported as %+v", ce)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.bin")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("corrupt file kept: %v", err)
+	}
+
+	if err := ParallelDownload(s.URL+"/f.bin", dir, "kept.bin", 4, WithChecksums(sums), WithKeepCorrupt()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want ErrChecksumMismatch", err)
+	}
+	checkFile(t, filepath.Join(dir, "kept.bin"+downloadSuffix), data)
+}
@@ -0,0 +1,275 @@
+// pdl 是基于 paralleldownload 的命令行下载工具：
+//
+//	pdl get URL... [-o name] [-d dir] [-w workers] [--resume] [--sha256 hex]
+//
+// 运行 pdl help 查看所有参数。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	pd "github.com/Doraemonkeys/ParallelDownload"
+)
+
+const usage = `pdl downloads files over parallel range requests.
+
+Usage:
+  pdl get [flags] URL...
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run 执行命令并返回退出码：0 成功，1 下载失败，2 参数错误。
+func run(args []string, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		newGetFlags(stderr).fs.PrintDefaults()
+		return 2
+	}
+	switch args[0] {
+	case "get":
+		return get(args[1:], stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stderr, usage)
+		newGetFlags(stderr).fs.PrintDefaults()
+		return 0
+	}
+	fmt.Fprintf(stderr, "pdl: unknown command %q, run 'pdl help'\n", args[0])
+	return 2
+}
+
+type getFlags struct {
+	fs        *flag.FlagSet
+	output    string
+	dir       string
+	workers   int64
+	resume    bool
+	sha256    string
+	checksums listFlag
+	headers   listFlag
+	chunkSize string
+	rateLimit string
+	retries   int
+	timeout   time.Duration
+	quiet     bool
+	json      bool
+}
+
+func newGetFlags(stderr io.Writer) *getFlags {
+	f := &getFlags{fs: flag.NewFlagSet("get", flag.ContinueOnError)}
+	fs := f.fs
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&f.output, "o", "", "save as `name` (default: the name from the server)")
+	fs.StringVar(&f.output, "output", "", "same as -o")
+	fs.StringVar(&f.dir, "d", ".", "save into `dir`")
+	fs.StringVar(&f.dir, "dir", ".", "same as -d")
+	fs.Int64Var(&f.workers, "w", 0, "number of parallel connections (default: one per MiB, up to $PARALLELDOWNLOAD_WORKERS or 4)")
+	fs.Int64Var(&f.workers, "workers", 0, "same as -w")
+	fs.BoolVar(&f.resume, "resume", false, "keep progress when interrupted and continue from it on the next run")
+	fs.StringVar(&f.sha256, "sha256", "", "verify the SHA-256 `hex` digest")
+	fs.Var(&f.checksums, "checksum", "verify `algo:hex` (md5, sha1, sha256, sha512, ...), repeatable")
+	fs.Var(&f.headers, "H", "add a request header `'Name: value'`, repeatable")
+	fs.Var(&f.headers, "header", "same as -H")
+	fs.StringVar(&f.chunkSize, "chunk-size", "", "split into chunks of `size` (e.g. 8M) instead of one part per worker")
+	fs.StringVar(&f.rateLimit, "limit-rate", "", "limit the total speed to `bytes` per second (e.g. 512K)")
+	fs.IntVar(&f.retries, "retry", 3, "attempts per part for transient errors")
+	fs.DurationVar(&f.timeout, "timeout", 0, "abort each download after `duration` (e.g. 10m)")
+	fs.BoolVar(&f.quiet, "q", false, "print errors only")
+	fs.BoolVar(&f.json, "json", false, "print progress as JSON lines")
+	return f
+}
+
+func get(args []string, stderr io.Writer) int {
+	f := newGetFlags(stderr)
+	urls, err := parseArgs(f.fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(stderr, "pdl: no url")
+		return 2
+	}
+	if f.output != "" && len(urls) > 1 {
+		fmt.Fprintln(stderr, "pdl: -o can only be used with a single url")
+		return 2
+	}
+	opts, err := f.options(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "pdl:", err)
+		return 2
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for _, u := range urls {
+		res, err := pd.ParallelDownloadContext(ctx, u, f.dir, f.output, f.workers, opts...)
+		if err != nil {
+			fmt.Fprintf(stderr, "pdl: %s: %v\n", u, err)
+			if f.resume && (ctx.Err() != nil || errors.Is(err, pd.ErrTimeoutResumable)) {
+				fmt.Fprintln(stderr, "pdl: progress saved, run the same command again to continue")
+			}
+			return 1
+		}
+		if !f.quiet {
+			fmt.Fprintf(stderr, "saved %s (%s in %s, %s/s)\n", res.Path, formatBytes(float64(res.Size)),
+				res.Elapsed.Round(time.Millisecond), formatBytes(res.Speed()))
+		}
+	}
+	return 0
+}
+
+// options 将参数转换为 Option。
+func (f *getFlags) options(stderr io.Writer) ([]pd.Option, error) {
+	opts := []pd.Option{pd.WithRetry(f.retries, time.Second)}
+	if f.resume {
+		opts = append(opts, pd.WithResume())
+	}
+	if f.sha256 != "" {
+		opts = append(opts, pd.WithChecksum("sha256", f.sha256))
+	}
+	for _, c := range f.checksums {
+		algo, sum, ok := strings.Cut(c, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid checksum %q, want algo:hex", c)
+		}
+		opts = append(opts, pd.WithChecksum(strings.ToLower(algo), sum))
+	}
+	for _, h := range f.headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header %q, want 'Name: value'", h)
+		}
+		opts = append(opts, pd.WithHeader(strings.TrimSpace(name), strings.TrimSpace(value)))
+	}
+	if f.chunkSize != "" {
+		n, err := parseSize(f.chunkSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", f.chunkSize)
+		}
+		opts = append(opts, pd.WithChunkSize(n))
+	}
+	if f.rateLimit != "" {
+		n, err := parseSize(f.rateLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit %q", f.rateLimit)
+		}
+		opts = append(opts, pd.WithRateLimit(n))
+	}
+	if f.timeout > 0 {
+		opts = append(opts, pd.WithTimeout(f.timeout))
+	}
+	switch {
+	case f.quiet:
+	case f.json:
+		opts = append(opts, pd.WithProgressJSON(stderr, 500*time.Millisecond))
+	default:
+		opts = append(opts, pd.WithProgressRecords(progressLine(stderr), 500*time.Millisecond))
+	}
+	return opts, nil
+}
+
+// parseArgs 解析参数，允许参数出现在 URL 之后，如 pdl get URL -o name。
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var urls []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return urls, nil
+		}
+		urls = append(urls, args[0])
+		args = args[1:]
+	}
+}
+
+// listFlag 为可以重复使用的参数。
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// progressLine 在同一行刷新进度，下载结束时换行。
+func progressLine(w io.Writer) func(pd.ProgressRecord) {
+	return func(r pd.ProgressRecord) {
+		line := formatBytes(float64(r.Downloaded))
+		if r.Total >= 0 {
+			line = fmt.Sprintf("%5.1f%%  %s / %s", r.Percent, line, formatBytes(float64(r.Total)))
+		}
+		line += fmt.Sprintf("  %s/s", formatBytes(r.Speed))
+		if r.ETA >= 0 && !r.Done {
+			line += fmt.Sprintf("  ETA %s", (time.Duration(r.ETA) * time.Second).String())
+		}
+		fmt.Fprintf(w, "\r%-60s", line)
+		if r.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// formatBytes 以 1024 为进制格式化字节数，如 1.5 MiB。
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// parseSize 解析形如 "512"、"64K"、"1.5M"、"2G" 的字节数。
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	unit := 1.0
+	if i := len(s) - 1; i >= 0 {
+		switch s[i] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit != 1 {
+			s = s[:i]
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	// ParseFloat 接受 "Inf"、"NaN" 与 "1e30"，转换为 int64 前检查范围
+	if n := f * unit; err != nil || !(n > 0 && n < math.MaxInt64) {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(f * unit), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	var stderr bytes.Buffer
+	f := newGetFlags(&stderr)
+	// 参数可以出现在 URL 之前、之间与之后
+	urls, err := parseArgs(f.fs, []string{"-w", "8", "http://a/1", "--resume", "http://a/2",
+		"-H", "X-A: 1", "--header=X-B: 2", "-d", "out", "--timeout", "90s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://a/1", "http://a/2"}; !reflect.DeepEqual(urls, want) {
+		t.Fatalf("urls = %q, want %q", urls, want)
+	}
+	if f.workers != 8 || !f.resume || f.dir != "out" || f.timeout != 90*time.Second {
+		t.Fatalf("workers = %d, resume = %v, dir = %q, timeout = %s", f.workers, f.resume, f.dir, f.timeout)
+	}
+	if want := (listFlag{"X-A: 1", "X-B: 2"}); !reflect.DeepEqual(f.headers, want) {
+		t.Fatalf("headers = %q, want %q", f.headers, want)
+	}
+	if f.retries != 3 || f.output != "" || f.quiet {
+		t.Fatalf("defaults: retries = %d, output = %q, quiet = %v", f.retries, f.output, f.quiet)
+	}
+
+	if _, err := parseArgs(newGetFlags(&stderr).fs, []string{"http://a/1", "-w", "many"}); err == nil {
+		t.Fatal("invalid -w accepted")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"512", 512},
+		{"64K", 64 << 10},
+		{"64kb", 64 << 10},
+		{"1.5M", 3 << 19},
+		{" 2G ", 2 << 30},
+		{"", 0},
+		{"0", 0},
+		{"-1K", 0},
+		{"abc", 0},
+		{"Inf", 0},
+		{"NaN", 0},
+		{"1e30", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("parseSize(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[float64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 3 << 20: "3.0 MiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+		msg  string
+	}{
+		{nil, 2, "Usage:"},
+		{[]string{"help"}, 0, "Usage:"},
+		{[]string{"get", "-h"}, 0, "Usage:"},
+		{[]string{"fetch"}, 2, `unknown command "fetch"`},
+		{[]string{"get"}, 2, "no url"},
+		{[]string{"get", "--bogus", "http://a/1"}, 2, "flag provided but not defined"},
+		{[]string{"get", "-o", "x", "http://a/1", "http://a/2"}, 2, "single url"},
+		{[]string{"get", "--checksum", "deadbeef", "http://a/1"}, 2, "invalid checksum"},
+		{[]string{"get", "-H", "no-colon", "http://a/1"}, 2, "invalid header"},
+		{[]string{"get", "--chunk-size", "huge", "http://a/1"}, 2, "invalid chunk size"},
+		{[]string{"get", "--limit-rate", "0", "http://a/1"}, 2, "invalid rate limit"},
+	}
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		if code := run(tt.args, &stderr); code != tt.code || !strings.Contains(stderr.String(), tt.msg) {
+			t.Errorf("run(%q) = %d, output %q; want %d with %q", tt.args, code, stderr.String(), tt.code, tt.msg)
+		}
+	}
+}
+
+func TestRunGet(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer s.Close()
+	dir := t.TempDir()
+
+	var stderr bytes.Buffer
+	if code := run([]string{"get", s.URL + "/f.bin", "-d", dir, "-o", "out.bin", "-w", "4", "-H", "X-Token: secret", "-q"}, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "out.bin")); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("saved file: %d bytes, err %v", len(got), err)
+	}
+	if stderr.Len() != 0 {
+		t.Fatalf("-q printed %q", stderr.String())
+	}
+
+	stderr.Reset()
+	if code := run([]string{"get", s.URL + "/f.bin", "-d", dir, "-o", "denied.bin", "--retry", "1", "-q"}, &stderr); code != 1 {
+		t.Fatalf("exit code %d for a failed download, want 1", code)
+	}
+	if !strings.Contains(stderr.String(), s.URL+"/f.bin") {
+		t.Fatalf("error output %q does not name the url", stderr.String())
+	}
+}
@@ -0,0 +1,111 @@
+package paralleldownload
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrRangeCoverage 表示服务器实际返回的数据范围(Content-Range)与请求的分片不一致，
+// 存在缺失或重叠的字节。
+var ErrRangeCoverage = errors.New("received ranges do not cover the file exactly")
+
+type byteRange struct {
+	start, end int64 // 均包含在内
+}
+
+// receivedRanges 记录各分片按 Content-Range 实际收到并写入的字节范围。
+type receivedRanges struct {
+	mu     sync.Mutex
+	ranges []byteRange
+}
+
+func (r *receivedRanges) add(start int64, written int64) {
+	if written <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ranges = append(r.ranges, byteRange{start: start, end: start + written - 1})
+}
+
+// verify 检查收到的范围是否恰好拼成 parts，不多不少也没有重叠。
+func (r *receivedRanges) verify(parts []part) error {
+	r.mu.Lock()
+	received := append([]byteRange(nil), r.ranges...)
+	r.mu.Unlock()
+	expected := make([]byteRange, 0, len(parts))
+	for _, p := range parts {
+		expected = append(expected, byteRange{start: p.start, end: p.end})
+	}
+	sortRanges(received)
+	var problems []string
+	for i := 1; i < len(received); i++ {
+		prev, cur := received[i-1], received[i]
+		if cur.start <= prev.end {
+			problems = append(problems, fmt.Sprintf("overlap %d-%d", cur.start, min64(prev.end, cur.end)))
+		}
+	}
+	got, want := mergeRanges(received), mergeRanges(expected)
+	for _, g := range subtractRanges(want, got) {
+		problems = append(problems, fmt.Sprintf("missing %d-%d", g.start, g.end))
+	}
+	for _, e := range subtractRanges(got, want) {
+		problems = append(problems, fmt.Sprintf("unexpected %d-%d", e.start, e.end))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrRangeCoverage, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+func sortRanges(rs []byteRange) {
+	sort.Slice(rs, func(i, j int) bool { return rs[i].start < rs[j].start })
+}
+
+// mergeRanges 合并相邻或重叠的范围。
+func mergeRanges(rs []byteRange) []byteRange {
+	rs = append([]byteRange(nil), rs...)
+	sortRanges(rs)
+	var merged []byteRange
+	for _, r := range rs {
+		if n := len(merged); n > 0 && r.start <= merged[n-1].end+1 {
+			if r.end > merged[n-1].end {
+				merged[n-1].end = r.end
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractRanges 返回 a 中不被 b 覆盖的部分，a 与 b 均需已合并。
+func subtractRanges(a, b []byteRange) []byteRange {
+	var out []byteRange
+	for _, r := range a {
+		cur := r.start
+		for _, s := range b {
+			if s.end < cur || s.start > r.end {
+				continue
+			}
+			if s.start > cur {
+				out = append(out, byteRange{start: cur, end: s.start - 1})
+			}
+			cur = s.end + 1
+		}
+		if cur <= r.end {
+			out = append(out, byteRange{start: cur, end: r.end})
+		}
+	}
+	return out
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,81 @@
+package paralleldownload
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRangeCoverageShiftedServer(t *testing.T) {
+	data := testContent(9000)
+	// 除第一个分片外，返回的范围比请求的晚 3 个字节，并如实写在 Content-Range 中
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		rng := r.Header.Get("Range")
+		if rng == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+			return
+		}
+		var start, end int
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		if start > 0 {
+			start += 3
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	}))
+
+	err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 3, WithFallbackPolicy(FallbackNever))
+	if !errors.Is(err, ErrRangeCoverage) {
+		t.Fatalf("err = %v, want ErrRangeCoverage", err)
+	}
+	// 报告中给出请求与实际收到的范围
+	if msg := err.Error(); !strings.Contains(msg, "Content-Range: bytes 3003-5999/9000") && !strings.Contains(msg, "Content-Range: bytes 6003-8999/9000") {
+		t.Fatalf("report %q does not show the shifted range", msg)
+	}
+}
+
+func TestReceivedRangesVerify(t *testing.T) {
+	parts := []part{{num: 0, start: 0, end: 99}, {num: 1, start: 100, end: 199}}
+	tests := []struct {
+		name     string
+		received [][2]int64 // start, written
+		problems []string
+	}{
+		{"exact", [][2]int64{{0, 100}, {100, 100}}, nil},
+		{"split writes", [][2]int64{{100, 50}, {0, 100}, {150, 50}}, nil},
+		{"gap", [][2]int64{{0, 100}, {110, 90}}, []string{"missing 100-109"}},
+		{"overlap", [][2]int64{{0, 105}, {100, 100}}, []string{"overlap 100-104"}},
+		{"beyond", [][2]int64{{0, 100}, {100, 110}}, []string{"unexpected 200-209"}},
+	}
+	for _, tt := range tests {
+		var r receivedRanges
+		for _, rg := range tt.received {
+			r.add(rg[0], rg[1])
+		}
+		err := r.verify(parts)
+		if len(tt.problems) == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrRangeCoverage) {
+			t.Errorf("%s: err = %v, want ErrRangeCoverage", tt.name, err)
+			continue
+		}
+		for _, p := range tt.problems {
+			if !strings.Contains(err.Error(), p) {
+				t.Errorf("%s: %q does not mention %s", tt.name, err, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package paralleldownload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+)
+
+// FileInfo 为获取文件信息后得到的远程文件信息，传给 WithDestinationFunc 的函数。
+type FileInfo struct {
+	URL string
+	// FinalURL 为跟随重定向后的地址，没有重定向时与 URL 相同
+	FinalURL string
+	// Name 为根据响应头或 url 推断的文件名
+	Name string
+	// Size 为文件大小，未知时为 -1
+	Size        int64
+	ContentType string
+	// RangeSupported 表示是否使用多线程下载
+	RangeSupported bool
+	Header         http.Header
+}
+
+// destination 返回保存文件的路径。设置了 WithDestinationFunc 时由其决定，
+// 一次下载中只调用一次，获取信息后回退到单线程下载时沿用第一次的结果。
+// 第一次确定路径时按 WithExistPolicy 检查文件是否已经存在。
+func (o *options) destination(ctx context.Context, info FileInfo, savePath string, filename string) (string, error) {
+	if t, err := http.ParseTime(info.Header.Get("Last-Modified")); err == nil {
+		o.modified = t
+	}
+	if o.destFunc == nil {
+		if filename == "" {
+			filename = info.Name
+		}
+		if o.savedPath != "" {
+			return o.savedPath, nil
+		}
+		if err := o.manifestChecksum(filename); err != nil {
+			return "", err
+		}
+		path, err := o.checkExisting(ctx, filepath.Join(savePath, filename), info)
+		if err != nil {
+			return "", err
+		}
+		o.savedPath = path
+		return o.savedPath, nil
+	}
+	if o.dest != "" {
+		o.savedPath = o.dest
+		return o.dest, nil
+	}
+	dir, name, err := o.destFunc(info)
+	if err != nil {
+		return "", fmt.Errorf("destination func error: %w", err)
+	}
+	if name == "" {
+		name = info.Name
+	}
+	if err := o.manifestChecksum(name); err != nil {
+		return "", err
+	}
+	if dir != "" {
+		if err := o.fsys().MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+	path, err := o.checkExisting(ctx, filepath.Join(dir, name), info)
+	if err != nil {
+		return "", err
+	}
+	o.dest = path
+	o.savedPath = o.dest
+	o.logger.Debug("destination chosen", "url", info.URL, "path", o.dest)
+	return o.dest, nil
+}
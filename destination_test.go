@@ -0,0 +1,65 @@
+package paralleldownload
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDestinationFunc(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".png") {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "application/zip")
+		}
+		serveData(data)(w, r)
+	}))
+
+	// 按内容类型分目录保存
+	root := t.TempDir()
+	var infos []FileInfo
+	byType := WithDestinationFunc(func(info FileInfo) (string, string, error) {
+		infos = append(infos, info)
+		kind := strings.SplitN(info.ContentType, "/", 2)[0]
+		return filepath.Join(root, kind), "", nil
+	})
+	res, err := ParallelDownloadEx(s.URL+"/a.png", t.TempDir(), "ignored.bin", 4, byType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "image", "a.png"); res.Path != want {
+		t.Fatalf("path = %s, want %s", res.Path, want)
+	}
+	checkFile(t, res.Path, data)
+	if len(infos) != 1 || infos[0].Size != int64(len(data)) || !infos[0].RangeSupported {
+		t.Fatalf("destination func called with %+v", infos)
+	}
+
+	// 单线程下载同样经过 fn
+	res, err = DownloadEx(s.URL+"/b.zip", "", "", byType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "application", "b.zip"); res.Path != want {
+		t.Fatalf("path = %s, want %s", res.Path, want)
+	}
+	checkFile(t, res.Path, data)
+
+	// fn 返回错误时中止，不创建任何文件
+	dir := t.TempDir()
+	reject := errors.New("unwanted content type")
+	err = ParallelDownload(s.URL+"/c.zip", dir, "", 4, WithDestinationFunc(func(FileInfo) (string, string, error) {
+		return "", "", reject
+	}))
+	if !errors.Is(err, reject) {
+		t.Fatalf("err = %v, want %v", err, reject)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("files created after abort: %v", entries)
+	}
+}
@@ -1,213 +1,1031 @@
 package paralleldownload
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// downloadSuffix 为下载过程中临时文件的后缀，下载并校验完成后重命名为目标文件名。
+// 开启 WithResume 时使用 partSuffix。
+const downloadSuffix = ".download"
+
+// ErrRangeNotSupported 表示服务器不支持 Range 请求，无法多线程下载。
+var ErrRangeNotSupported = errors.New("range request not supported")
+
+// ErrUnstableContent 表示分片响应中的文件总大小与获取文件信息时不一致，或文件的 ETag、Last-Modified
+// 已经变化(If-Range 不匹配)，通常是动态生成或下载途中被更新的内容，拼接出的文件不可靠。
+var ErrUnstableContent = errors.New("content changed during download")
+
+// ErrSizeMismatch 表示收到的数据量与响应的 Content-Length 不一致，通常是连接提前断开。
+var ErrSizeMismatch = errors.New("size not match")
+
+// ErrMagicMismatch 表示文件开头的字节与 WithExpectedMagic 指定的不一致。
+var ErrMagicMismatch = errors.New("magic bytes not match")
+
 type worker struct {
 	Url       string
-	File      *os.File
+	File      io.WriterAt
 	Count     int64
 	TotalSize int64
+	opts      *options
+	pieces    *orderedTee // WithPieceChecksums 的分块校验
+	clients   []*http.Client
+	progress  *progressReporter
+	steal     *stealer
+	mirrors   *mirrorSet
+
+	urlMu sync.Mutex
 }
 
 // filename为文件名，savePath为文件存储的路径，两者都可省略。
-func Download(url string, savePath string, filename string) error {
-	request, err := http.NewRequest("GET", url, nil)
-	request.Header.Set("user-agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36")
+func Download(url string, savePath string, filename string, opts ...Option) error {
+	_, err := DownloadEx(url, savePath, filename, opts...)
+	return err
+}
+
+// DownloadEx 与 Download 相同，同时返回下载结果。
+func DownloadEx(url string, savePath string, filename string, opts ...Option) (*DownloadResult, error) {
+	return DownloadContext(context.Background(), url, savePath, filename, opts...)
+}
+
+// DownloadContext 与 DownloadEx 相同，ctx 取消时停止下载并返回 ctx.Err()，
+// 不完整的文件会被删除(WithKeepPartial 时保留)。
+func DownloadContext(ctx context.Context, url string, savePath string, filename string, opts ...Option) (*DownloadResult, error) {
+	return (&Downloader{}).DownloadContext(ctx, url, savePath, filename, opts...)
+}
+
+func download(ctx context.Context, url string, savePath string, filename string, o *options) error {
+	o.parallel = false
+	o.emitter.start(url)
+	resp, body, err := openStream(ctx, url, o)
 	if err != nil {
 		return err
 	}
-	resp, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return fmt.Errorf("访问url失败,err:%w", err)
+	defer body.Close()
+	o.emitter.probe(o.bodyLength(resp), false, nil)
+	o.finalURL = resp.Request.URL.String()
+	filepath, err := o.destination(ctx, FileInfo{
+		URL:         url,
+		FinalURL:    o.finalURL,
+		Name:        generateDownloadFileName(url, o.finalURL, resp.Header, o),
+		Size:        o.bodyLength(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+	}, savePath, filename)
+	if errors.Is(err, errSkipExisting) {
+		return nil
 	}
-	defer resp.Body.Close()
-	name := generateDownloadFileName(url, resp.Header)
-	if filename == "" {
-		filename = name
+	if err != nil {
+		return err
 	}
-	filepath := filepath.Join(savePath, filename)
-	// 创建一个文件用于保存
-	out, err := os.Create(filepath)
+	// 先写入临时文件，完成后再重命名，保存路径上不会出现不完整的文件
+	dataPath := filepath + downloadSuffix
+	out, err := o.openDest(dataPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	_, err = io.Copy(out, resp.Body)
+	var dst io.Writer = out
+	if o.onData != nil {
+		dst = io.MultiWriter(dst, &callbackWriter{fn: o.onData})
+	}
+	if o.tee != nil {
+		dst = io.MultiWriter(dst, &teeWriter{ctx: ctx, t: o.tee})
+	}
+	progress := o.newProgress(o.bodyLength(resp), nil)
+	if progress != nil {
+		dst = io.MultiWriter(dst, progressWriter{r: progress})
+	}
+	dst = io.MultiWriter(dst, &statsWriter{s: &o.stats, max: o.maxSize})
+	o.emitter.part(ChunkStarted, streamPart(o.bodyLength(resp)), 0, nil)
+	o.meter.addActive(1)
+	n, err := io.Copy(dst, body)
+	o.meter.addActive(-1)
+	progress.finish(err)
+	o.audit.record(url, part{num: 0, start: 0, end: n - 1}, n, err)
+	o.emitter.part(ChunkCompleted, part{num: 0, start: 0, end: n - 1}, n, err)
 	if err != nil {
+		out.Close()
+		if !o.keepPartial {
+			removeIncomplete(dataPath, err, o)
+		}
 		return err
 	}
-	return nil
+	if len(o.checksums) > 0 {
+		if err := verifyChecksums(io.NewSectionReader(out, 0, n), o.checksums); err != nil {
+			out.Close()
+			removeCorrupt(dataPath, err, o)
+			return err
+		}
+	}
+	out.Close()
+	return o.renameDest(dataPath, filepath)
 }
 
-func generateDownloadFileName(url string, header http.Header) string {
-	name := getFileNameByHeader(header)
-	if name != "" {
-		return name
+// openStream 发送普通的 GET 请求，返回响应与经过限速、解码、magic 检查的响应体，
+// 调用者需要关闭返回的响应体。
+func openStream(ctx context.Context, url string, o *options) (*http.Response, io.ReadCloser, error) {
+	request, err := o.newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, nil, err
 	}
-	name, err := getFileNameFromUrl(url)
-	if err != nil || name == "" {
-		return time.Now().Format("20060102150405") + "_unknown"
+	if o.compression {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	} else if o.keepEncoded {
+		// 自行设置 Accept-Encoding 后 net/http 不再自动解压 gzip
+		request.Header.Set("Accept-Encoding", identityEncoding)
 	}
-	return name
+	resp, err := o.do(o.client, request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("访问url失败,err:%w", err)
+	}
+	if err := o.checkETag(resp); err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 400 {
+		// 不把错误页面当作文件内容保存
+		closeBody(resp)
+		return nil, nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	limited := &readCloser{Reader: o.bodyReader(ctx, resp.Body), close: []func(){func() { resp.Body.Close() }}}
+	var body io.ReadCloser = limited
+	if !o.keepEncoded {
+		if body, err = decodeBody(resp.Header, limited); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(o.expectedMagic) > 0 {
+		decoded := body
+		r, err := checkMagic(decoded, o.expectedMagic)
+		if err != nil {
+			decoded.Close()
+			return nil, nil, err
+		}
+		body = &readCloser{Reader: r, close: []func(){func() { decoded.Close() }}}
+	}
+	return resp, body, nil
+}
+
+// generateDownloadFileName 依次从最终响应的头部、重定向后的 final、最初的 url 推断文件名。
+// final 的文件名没有扩展名(如签名的对象存储地址)时优先使用 url 的文件名。
+func generateDownloadFileName(url string, final string, header http.Header, o *options) string {
+	if !o.ignoreServerFilename {
+		if name := sanitizeFileName(getFileNameByHeader(header)); name != "" {
+			return name
+		}
+	}
+	var fallback string
+	for _, u := range []string{final, url} {
+		name, err := getFileNameFromUrl(u)
+		if name = sanitizeFileName(name); err != nil || name == "" {
+			continue
+		}
+		if filepath.Ext(name) != "" || u == url {
+			return name
+		}
+		if fallback == "" {
+			fallback = name
+		}
+	}
+	if fallback != "" {
+		return fallback
+	}
+	return time.Now().Format("20060102150405") + "_unknown"
 }
 
 // url为下载直链，若不支持多线程下载将尝试普通下载。
 // filename为文件名，savePath为文件存储的路径，两者都可省略。
-func ParallelDownload(download_url string, savePath string, filename string, worker_count int64) (err error) {
-	file_size, header, err := getInfoAndCheckRangeSupport(download_url)
+func ParallelDownload(download_url string, savePath string, filename string, worker_count int64, opts ...Option) (err error) {
+	_, err = ParallelDownloadEx(download_url, savePath, filename, worker_count, opts...)
+	return err
+}
+
+// ParallelDownloadEx 与 ParallelDownload 相同，同时返回下载结果。
+// 下载失败时也会返回已统计的结果。
+func ParallelDownloadEx(download_url string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return ParallelDownloadContext(context.Background(), download_url, savePath, filename, worker_count, opts...)
+}
+
+// ParallelDownloadContext 与 ParallelDownloadEx 相同，ctx 取消时所有线程尽快停止并返回 ctx.Err()，
+// 不完整的文件会被删除(WithKeepPartial 时保留，开启 WithResume 时保留续传进度)。
+func ParallelDownloadContext(ctx context.Context, download_url string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return (&Downloader{}).ParallelDownloadContext(ctx, download_url, savePath, filename, worker_count, opts...)
+}
+
+func parallelDownload(ctx context.Context, download_url string, savePath string, filename string, worker_count int64, o *options) error {
+	o.emitter.start(download_url)
+	download_url, file_size, header, resolved, err := o.probe(ctx, download_url)
+	if errors.Is(err, ErrETagMismatch) || ctx.Err() != nil {
+		return err
+	}
+	if err == nil {
+		if err := o.checkSize(file_size); err != nil {
+			return err
+		}
+	}
 	if err != nil {
-		fmt.Println("get file info failed:", err)
+		o.logger.Debug("download plan", append([]any{"url", download_url, "range_support", false, "reason", err.Error()}, o.logArgs()...)...)
+		if err := o.fallback(err, rangeUnsupported(err)); err != nil {
+			return err
+		}
+		o.emitter.unranged(err)
+		o.logger.Info("fallback to single stream", "url", download_url, "reason", err.Error())
 		//不支持多线程下载，尝试普通下载
-		return Download(download_url, savePath, filename)
+		return download(ctx, download_url, savePath, filename, o)
 	}
-	name := generateDownloadFileName(download_url, header)
-	if filename == "" {
-		filename = name
+	o.finalURL = resolved
+	o.emitter.probe(file_size, true, nil)
+	filePath, err := o.destination(ctx, FileInfo{
+		URL:            download_url,
+		FinalURL:       resolved,
+		Name:           generateDownloadFileName(download_url, resolved, header, o),
+		Size:           file_size,
+		ContentType:    header.Get("Content-Type"),
+		RangeSupported: true,
+		Header:         header,
+	}, savePath, filename)
+	if errors.Is(err, errSkipExisting) {
+		return nil
 	}
-	filePath := filepath.Join(savePath, filename)
-	if file_size <= 0 {
+	if err != nil {
+		return err
+	}
+	if file_size == 0 {
+		// 空文件无需分片，由单线程下载创建
+		o.logger.Debug("empty file, download by single stream", "url", download_url, "path", filePath)
+		return download(ctx, download_url, filepath.Dir(filePath), filepath.Base(filePath), o)
+	}
+	if file_size < 0 {
 		return errors.New("get file size failed")
 	}
-	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if worker_count <= 0 {
+		worker_count = o.autoWorkers(file_size)
+	}
+	parts := splitParts(file_size, o.partCount(file_size, worker_count))
+	ranges := make([]string, 0, len(parts))
+	for _, p := range parts {
+		ranges = append(ranges, fmt.Sprintf("%d-%d", p.start, p.end))
+	}
+	o.logger.Debug("download plan", append([]any{"url", download_url, "resolved_url", resolved, "path", filePath, "size", file_size,
+		"range_support", true, "mirrors", o.mirrors, "workers", worker_count, "concurrency", o.concurrency, "parts", ranges}, o.logArgs()...)...)
+	flag := os.O_CREATE | os.O_RDWR | os.O_TRUNC
+	dataPath := filePath + downloadSuffix
+	if o.resume {
+		dataPath = filePath + partSuffix
+		o.checkpoint = newCheckpoint(filePath, dataPath, download_url, file_size, header, parts, o)
+		if o.checkpoint.resumed {
+			flag = os.O_CREATE | os.O_RDWR
+			parts = o.checkpoint.pending()
+			o.logger.Info("resume download", "path", filePath, "pending_parts", len(parts))
+		}
+	}
+	f, err := o.openDest(dataPath, flag)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	errGroup, ctx := errgroup.WithContext(context.Background())
+	if o.checkpoint == nil || !o.checkpoint.resumed {
+		// 预先分配全部空间，磁盘空间不足时在开始下载前失败，也减少乱序写入造成的碎片
+		if err := preallocateFile(f, file_size); err != nil {
+			f.Close()
+			removeIncomplete(dataPath, err, o)
+			return fmt.Errorf("preallocate error: %w", err)
+		}
+	}
+	if o.checkpoint != nil {
+		o.checkpoint.start(f)
+	}
+	store := &fileStore{file: f, checkpoint: o.checkpoint}
+	err = runParts(ctx, resolved, store, file_size, parts, o)
+	if err == nil {
+		err = store.Finalize()
+	}
+	if o.checkpoint != nil {
+		if cerr := o.checkpoint.finish(err == nil); cerr != nil {
+			o.logger.Warn("save download progress failed", "path", o.checkpoint.path, "err", cerr)
+		}
+		if err != nil && timedOut(ctx, err) {
+			return &resumableError{err: err}
+		}
+	}
+	if err != nil {
+		assumedWrong := o.assumeRangeSupport && errors.Is(err, ErrRangeNotSupported)
+		// 重定向后的地址不能重复请求(如一次性签名链接)时从原始地址单线程下载
+		rejected := resolved != download_url && resolvedRejected(err)
+		if assumedWrong || rejected {
+			if ferr := o.fallback(err, true); ferr != nil {
+				err = ferr
+			} else {
+				if assumedWrong {
+					// 假定支持 Range 但服务器并不支持，改为普通下载
+					o.logger.Warn("assumed range support is wrong, fallback to single stream", "url", download_url, "err", err)
+				} else {
+					o.logger.Warn("resolved url rejected range requests, fallback to single stream", "url", download_url, "resolved_url", resolved, "err", err)
+				}
+				f.Close()
+				return download(ctx, download_url, filepath.Dir(filePath), filepath.Base(filePath), o)
+			}
+		}
+		if !o.resume && !o.keepPartial {
+			// 未开启续传时不保留不完整的文件
+			f.Close()
+			removeIncomplete(dataPath, err, o)
+		}
+		return err
+	}
+	if len(o.checksums) > 0 {
+		if err := verifyChecksums(io.NewSectionReader(f, 0, file_size), o.checksums); err != nil {
+			f.Close()
+			removeCorrupt(dataPath, err, o)
+			return err
+		}
+	}
+	f.Close()
+	return o.renameDest(dataPath, filePath)
+}
+
+// runParts 并发下载各分片并写入 dst。
+func runParts(ctx context.Context, download_url string, dst PartStore, file_size int64, parts []part, o *options) error {
+	o.parallel = true
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errGroup, ctx := errgroup.WithContext(ctx)
 	// New worker struct to download file
 	var worker = worker{
 		Url:       download_url,
-		File:      f,
-		Count:     worker_count,
+		File:      dst,
+		Count:     int64(len(parts)),
 		TotalSize: file_size,
+		opts:      o,
+		clients:   o.partClients(int64(len(parts))),
+		mirrors:   o.newMirrorSet(download_url),
+	}
+	defer closePartClients(worker.clients)
+	var verifier *pieceVerifier
+	if len(o.pieceSums) > 0 {
+		var err error
+		verifier, err = newPieceVerifier(ctx, &worker, dst, file_size, o)
+		if err != nil {
+			return err
+		}
+		worker.pieces = newOrderedTee([]io.Writer{verifier}, o.teeBuffer)
+	}
+	for _, t := range []*orderedTee{o.tee, worker.pieces} {
+		if t == nil {
+			continue
+		}
+		if err := t.feedCompleted(dst); err != nil {
+			return err
+		}
+		t := t
+		go func() {
+			<-ctx.Done()
+			t.wake()
+		}()
+	}
+	worker.progress = o.newProgress(file_size, parts)
+	if o.concurrency > 0 {
+		// 同时下载的分片数不超过 concurrency，有空位时再开始下一个分片
+		errGroup.SetLimit(o.concurrency)
+	}
+	worker.steal = o.newStealer(parts)
+	var failed partErrors
+	runPart := func(p part) error {
+		began := time.Now()
+		o.logger.Debug("part start", "part", p.num, "start", p.start, "end", p.end)
+		o.emitter.part(ChunkStarted, p, 0, nil)
+		o.meter.addActive(1)
+		written, err := worker.downloadPart(ctx, p)
+		o.meter.addActive(-1)
+		p = worker.steal.finish(p)
+		o.logger.Debug("part finish", "part", p.num, "start", p.start, "end", p.end, "written", written,
+			"elapsed", time.Since(began), "err", err)
+		o.audit.record(download_url, p, written, err)
+		o.report.addPart(p, began, written, err)
+		o.emitter.part(ChunkCompleted, p, written, err)
+		// 其他分片失败后被取消的分片不计入
+		if err != nil && !(errors.Is(err, context.Canceled) && parent.Err() == nil) {
+			failed.add(p, err)
+			o.meter.partFailed()
+		}
+		return err
+	}
+	for _, p := range parts {
+		p := p
+		errGroup.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				// 等待空位期间下载已经失败或被取消
+				return err
+			}
+			worker.steal.begin(p)
+			err := runPart(p)
+			// 没有待开始的分片后，继续下载从较慢的分片拆分出的部分
+			for err == nil {
+				stolen, ok := worker.steal.steal()
+				if !ok {
+					break
+				}
+				o.logger.Debug("split slow part", "part", stolen.num, "start", stolen.start, "end", stolen.end)
+				err = runPart(stolen)
+			}
+			return err
+		})
+	}
+	err := errGroup.Wait()
+	if err != nil && parent.Err() == nil {
+		if perr := failed.err(); perr != nil {
+			err = perr
+		}
+	}
+	if err == nil {
+		err = o.received.verify(parts)
+	}
+	if err == nil && verifier != nil && !verifier.done() {
+		err = fmt.Errorf("%w: only %d of %d pieces verified", ErrChecksumMismatch, verifier.index, len(verifier.sums))
+	}
+	worker.progress.finish(err)
+	return err
+}
+
+// minAutoPartSize 为 worker_count <= 0 时每个分片的最小字节数，小文件不会被拆成过多的分片。
+const minAutoPartSize = 1 << 20
+
+// autoWorkers 返回 worker_count <= 0 时使用的线程数：按每个分片至少 minAutoPartSize 字节计算，
+// 不超过 WithWorkers(或环境变量、默认值)设置的线程数。
+func (o *options) autoWorkers(file_size int64) int64 {
+	n := (file_size + minAutoPartSize - 1) / minAutoPartSize
+	if n > o.workers {
+		n = o.workers
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// maxChunks 为 WithChunkSize 分出的分块数上限，超过时增大分块，避免分块过小时
+// 进度、续传记录与报告中的分片过多。
+const maxChunks = 10000
+
+// partCount 返回文件分为的分片数，默认与 worker_count 相同。设置了 WithChunkSize 时
+// 按分块大小计算(不超过 maxChunks)，未设置 WithConcurrency 时以 worker_count 作为同时下载的分片数。
+func (o *options) partCount(file_size int64, worker_count int64) int64 {
+	if o.chunkSize <= 0 {
+		return worker_count
+	}
+	if o.concurrency == 0 {
+		o.concurrency = int(worker_count)
+	}
+	count := (file_size + o.chunkSize - 1) / o.chunkSize
+	if count > maxChunks {
+		o.logger.Debug("chunk size too small, using fewer chunks", "chunk_size", o.chunkSize, "chunks", maxChunks)
+		count = maxChunks
 	}
+	return count
+}
+
+// part 为文件的一个分片，start 与 end 均包含在内。
+type part struct {
+	num   int64
+	start int64
+	end   int64
+}
+
+// splitParts 将文件等分为 count 个分片，最后一个分片包含余下的字节。
+// count 大于文件大小时每个字节一个分片。
+func splitParts(file_size int64, count int64) []part {
+	if count > file_size {
+		count = file_size
+	}
+	if count < 1 {
+		count = 1
+	}
+	var parts []part
 	var start, end int64
-	var partial_size = int64(file_size / worker_count)
-	for num := int64(0); num < worker.Count; num++ {
-		if num == worker.Count-1 {
+	var partial_size = int64(file_size / count)
+	for num := int64(0); num < count; num++ {
+		if num == count-1 {
 			end = file_size // last part
 		} else {
 			end = start + partial_size
 		}
-		tempNum := num
-		tempStart := start
-		tempEnd := end
-		errGroup.Go(func() error {
-			return worker.writeRange(ctx, tempNum, tempStart, tempEnd-1) // end-1
-		})
+		parts = append(parts, part{num: num, start: start, end: end - 1})
 		start = end
 	}
-	if err := errGroup.Wait(); err != nil {
-		// 处理可能出现的错误
-		return err
+	return parts
+}
+
+// downloadPart 下载分片 p，分片被 Handle.CancelPart 取消或 Handle.Pause 暂停时从已写入的位置继续下载剩余部分。
+func (w *worker) downloadPart(ctx context.Context, p part) (int64, error) {
+	var total int64
+	var restarts, retries int
+	w.progress.setState(p.num, partDownloading)
+	for attempt := 1; ; {
+		if err := w.opts.handle.waitResumed(ctx); err != nil {
+			w.progress.setState(p.num, partFailed)
+			return total, err
+		}
+		partCtx, requeued := w.opts.handle.track(ctx, p.num)
+		written, err := w.writeRange(partCtx, p.num, p.start, p.end)
+		// 总是结束跟踪，否则已完成的分片仍可被 CancelPart 取消
+		canceled := requeued()
+		total += written
+		// 重试时从已写入的位置继续，分片可能已被拆分
+		p.start += written
+		p.end = w.steal.endOf(p.num, p.end)
+		if err != nil && canceled && ctx.Err() == nil {
+			retries++
+			w.retried(p, retries, err)
+			w.opts.logger.Info("part requeued", "part", p.num, "start", p.start, "end", p.end)
+			continue
+		}
+		if err != nil && ctx.Err() == nil && p.start <= p.end {
+			if mirror, ok := w.mirrors.failover(p.num, err); ok {
+				// 剩余的部分改从其他镜像下载
+				attempt = 1
+				retries++
+				w.retried(p, retries, err)
+				w.opts.logger.Warn("mirror demoted", "part", p.num, "mirror", mirror, "start", p.start, "err", err)
+				continue
+			}
+		}
+		if err == nil && written > 0 && p.start <= p.end {
+			// 服务器只返回了请求范围的前一部分，继续请求剩余的部分
+			w.opts.logger.Debug("short range response, requesting the rest", "part", p.num, "start", p.start, "end", p.end)
+			continue
+		}
+		if written > 0 {
+			attempt = 1
+		}
+		if err != nil && ctx.Err() == nil && p.start <= p.end && errors.Is(err, ErrPartStalled) && restarts < maxStallRestarts {
+			restarts++
+			retries++
+			w.retried(p, retries, err)
+			w.opts.logger.Warn("part stalled, restarting", "part", p.num, "start", p.start, "end", p.end, "err", err)
+			continue
+		}
+		if err != nil && attempt < w.opts.retryAttempts && p.start <= p.end && isTransient(err) {
+			wait := retryBackoff(w.opts.retryBackoff, attempt)
+			w.opts.logger.Warn("part failed, retrying", "part", p.num, "attempt", attempt, "wait", wait, "start", p.start, "err", err)
+			if serr := sleepContext(ctx, wait); serr == nil {
+				attempt++
+				retries++
+				w.retried(p, retries, err)
+				continue
+			}
+		}
+		if err != nil {
+			w.progress.setState(p.num, partFailed)
+		} else {
+			w.progress.setState(p.num, partDone)
+		}
+		return total, err
 	}
-	return nil
 }
 
-func (w *worker) writeRange(ctx context.Context, part_num int64, start int64, end int64) error {
-	var written int64
-	body, size, err := w.getRangeBody(start, end)
+// retried 记录分片的一次重试，attempt 为该分片的第几次重试。
+func (w *worker) retried(p part, attempt int, err error) {
+	w.opts.stats.retries.Add(1)
+	w.opts.emitter.emit(Event{Type: ChunkRetried, Part: p.num, Start: p.start, End: p.end, Attempt: attempt, Err: err})
+}
+
+func (w *worker) writeRange(ctx context.Context, part_num int64, start int64, end int64) (written int64, err error) {
+	ctx, stall := w.watchStall(ctx)
+	defer stall.stop()
+	defer func() {
+		if reason := stall.stalled(); err != nil && reason != "" {
+			err = fmt.Errorf("part %d download error: %w: %s", part_num, ErrPartStalled, reason)
+		}
+	}()
+	body, err := w.requestRange(ctx, w.clientFor(part_num), part_num, start, end, stall)
+	stall.disarm()
 	if err != nil {
-		return fmt.Errorf("part %d request error: %w", part_num, err)
+		return written, fmt.Errorf("part %d request error: %w", part_num, err)
 	}
 	defer body.Close()
+	defer func() {
+		w.opts.received.add(body.start, written)
+	}()
+	size := body.size
+	var reader = w.opts.bodyReader(ctx, stall.reader(body))
+	if start == 0 && len(w.opts.expectedMagic) > 0 {
+		reader, err = checkMagic(reader, w.opts.expectedMagic)
+		if err != nil {
+			return written, fmt.Errorf("part %d check error: %w", part_num, err)
+		}
+	}
 	// make a buffer to keep chunks that are read
-	buf := make([]byte, 4*1024)
+	bufp := w.opts.buffers.Get().(*[]byte)
+	defer w.opts.buffers.Put(bufp)
+	buf := *bufp
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return written, ctx.Err()
 		default:
 		}
-		nr, err2 := body.Read(buf)
+		nr, err2 := fillBuffer(reader, buf)
 		if nr > 0 {
+			if nr = w.steal.reserve(part_num, start, nr); nr == 0 {
+				// 后面的部分已经拆分给其他线程
+				return written, nil
+			}
 			nw, err := w.File.WriteAt(buf[0:nr], start)
 			if err != nil {
-				return fmt.Errorf("part %d write error: %w", part_num, err)
+				return written, fmt.Errorf("part %d write error: %w", part_num, err)
 			}
 			if nr != nw {
-				return fmt.Errorf("part %d write error: %s", part_num, "short write")
+				return written, fmt.Errorf("part %d write error: %s", part_num, "short write")
+			}
+			if w.opts.onData != nil {
+				if err := w.opts.onData(start, buf[0:nr]); err != nil {
+					return written, fmt.Errorf("part %d callback error: %w", part_num, err)
+				}
+			}
+			if err := w.opts.tee.write(ctx, start, buf[0:nr]); err != nil {
+				return written, fmt.Errorf("part %d tee write error: %w", part_num, err)
+			}
+			if err := w.pieces.write(ctx, start, buf[0:nr]); err != nil {
+				return written, fmt.Errorf("part %d verify error: %w", part_num, err)
 			}
 			start = int64(nw) + start
 			if nw > 0 {
 				written += int64(nw)
+				w.opts.stats.written.Add(int64(nw))
+				w.opts.checkpoint.add(part_num, int64(nw))
+				w.progress.add(part_num, int64(nw))
+			}
+			if w.steal != nil && start > w.steal.endOf(part_num, end) {
+				return written, nil
 			}
 		}
 		if err2 != nil {
 			if err2 == io.EOF {
 				if size == written {
 					// Download successfully
-					return nil
+					return written, nil
 				} else {
-					return fmt.Errorf("part %d download error: %s", part_num, "size not match")
+					return written, fmt.Errorf("part %d download error: %w: got %d of %d bytes", part_num, ErrSizeMismatch, written, size)
 				}
 			}
-			return fmt.Errorf("part %d download error: %w", part_num, err2)
+			return written, fmt.Errorf("part %d download error: %w", part_num, err2)
+		}
+	}
+}
+
+// requestRange 为分片 part_num 请求 [start, end] 范围的数据，链接过期时通过 URLProvider 刷新后重试
+// (使用镜像时改为换用其他镜像)，服务器返回 Retry-After 时等待后重试。
+// 刷新链接与等待 Retry-After 期间暂停 stall 的计时，下一次请求时重新开始。
+func (w *worker) requestRange(ctx context.Context, client *http.Client, part_num int64, start int64, end int64, stall *stallWatch) (*rangeBody, error) {
+	var refreshes, waits int
+	for {
+		url := w.urlFor(part_num)
+		body, err := w.getRangeBody(ctx, client, url, start, end)
+		var retryErr *retryAfterError
+		switch {
+		case errors.Is(err, ErrURLExpired) && w.opts.urlProvider != nil && w.mirrors == nil && refreshes < maxURLRefreshes:
+			refreshes++
+			w.opts.stats.retries.Add(1)
+			stall.disarm()
+			if err := w.refreshURL(ctx, url); err != nil {
+				return nil, err
+			}
+			stall.arm()
+		case errors.As(err, &retryErr) && waits < maxRetryAfterRetries:
+			waits++
+			w.opts.stats.retries.Add(1)
+			wait, err := w.opts.retryAfterWait(retryErr.after)
+			if err != nil {
+				return nil, err
+			}
+			w.opts.logger.Info("server asked to retry later", "status", retryErr.status,
+				"retry_after", retryErr.after, "wait", wait, "start", start, "end", end)
+			stall.disarm()
+			if err := sleepContext(ctx, wait); err != nil {
+				return nil, err
+			}
+			stall.arm()
+		default:
+			return body, err
 		}
 	}
 }
 
-func (w *worker) getRangeBody(start int64, end int64) (io.ReadCloser, int64, error) {
-	var client http.Client
-	req, err := http.NewRequest("GET", w.Url, nil)
-	// req.Header.Set("cookie", "")
+// rangeBody 为分片请求的响应体。
+type rangeBody struct {
+	io.ReadCloser
+	// size 为 Content-Length
+	size int64
+	// start、end 与 total 来自 Content-Range，total 未知时为 -1
+	start int64
+	end   int64
+	total int64
+}
+
+func (w *worker) getRangeBody(ctx context.Context, client *http.Client, url string, start int64, end int64) (*rangeBody, error) {
+	req, err := w.opts.newRequest(ctx, "GET", url)
 	// log.Printf("Request header: %s\n", req.Header)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	// Set range header
 	req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", start, end))
-	resp, err := client.Do(req)
+	req.Header.Set("Accept-Encoding", identityEncoding)
+	if w.opts.validator != "" && w.opts.expectETag == "" {
+		req.Header.Set("If-Range", w.opts.validator)
+	}
+	resp, err := w.opts.do(client, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.opts.checkETag(resp); err != nil {
+		closeBody(resp)
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer closeBody(resp)
+		if resp.StatusCode == http.StatusForbidden && w.opts.urlExpired(resp) {
+			return nil, fmt.Errorf("%w: %s", ErrURLExpired, resp.Status)
+		}
+		if err := retryAfter(resp); err != nil {
+			return nil, err
+		}
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	if validator := req.Header.Get("If-Range"); validator != "" {
+		// 获取信息时已确认支持 Range，此时返回 200 说明文件已经变化，服务器因 If-Range 不匹配返回了整个新文件
+		if resp.StatusCode == http.StatusOK && !w.opts.assumeRangeSupport {
+			closeBody(resp)
+			return nil, fmt.Errorf("%w: If-Range %s no longer matches", ErrUnstableContent, validator)
+		}
+		// 忽略 If-Range 的服务器仍返回 206 时比对 ETag
+		if etag := resp.Header.Get("ETag"); resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(validator, "\"") && etag != "" && etag != validator {
+			closeBody(resp)
+			return nil, fmt.Errorf("%w: ETag changed from %s to %s", ErrUnstableContent, validator, etag)
+		}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: server responded %s to a range request", ErrRangeNotSupported, resp.Status)
+	}
+	if w.opts.encoded(resp.Header) {
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: range response is encoded as %q", ErrRangeNotSupported, resp.Header.Get("Content-Encoding"))
+	}
+	crStart, crEnd, total, err := parseContentRange(resp.Header.Get("Content-Range"))
 	if err != nil {
-		return nil, 0, err
+		closeBody(resp)
+		return nil, err
+	}
+	if total >= 0 && total != w.TotalSize {
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: total size %d in Content-Range, but %d when probed", ErrUnstableContent, total, w.TotalSize)
+	}
+	if crStart != start || crEnd > end {
+		// 返回的范围与请求的不一致，写入请求的位置会损坏文件
+		closeBody(resp)
+		return nil, fmt.Errorf("%w: requested bytes %d-%d, server responded `Content-Range: %s`", ErrRangeCoverage, start, end, resp.Header.Get("Content-Range"))
+	}
+	// 分块传输等情况下没有 Content-Length，长度由 Content-Range 得出
+	size := crEnd - crStart + 1
+	if v := resp.Header.Get("Content-Length"); v != "" {
+		size, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			closeBody(resp)
+			return nil, fmt.Errorf("invalid Content-Length %q: %w", v, err)
+		}
+		if size != crEnd-crStart+1 {
+			closeBody(resp)
+			return nil, fmt.Errorf("invalid Content-Length %d for `Content-Range: %s`", size, resp.Header.Get("Content-Range"))
+		}
+	} else if crEnd < crStart {
+		closeBody(resp)
+		return nil, fmt.Errorf("range response has no Content-Length and an invalid Content-Range %q", resp.Header.Get("Content-Range"))
 	}
-	size, err := strconv.ParseInt(resp.Header["Content-Length"][0], 10, 64)
-	return resp.Body, size, err
+	return &rangeBody{ReadCloser: resp.Body, size: size, start: crStart, end: crEnd, total: total}, nil
+}
+
+// bodyReader 为响应体加上暂停控制与限速。
+func (o *options) bodyReader(ctx context.Context, r io.Reader) io.Reader {
+	return o.limitReader(ctx, o.gateReader(ctx, r))
 }
 
-func getInfoAndCheckRangeSupport(url string) (size int64, header http.Header, err error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+// checkMagic 读取开头的 len(magic) 个字节并与 magic 比较，
+// 返回的 Reader 仍包含已读取的字节。
+func checkMagic(r io.Reader, magic []byte) (io.Reader, error) {
+	head := make([]byte, len(magic))
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(head[:n], magic) {
+		return nil, fmt.Errorf("%w: got %q, want %q", ErrMagicMismatch, head[:n], magic)
+	}
+	return io.MultiReader(bytes.NewReader(head[:n]), r), nil
+}
+
+// getInfoAndCheckRangeSupport 先用 HEAD 获取文件信息，HEAD 失败、未给出大小或没有
+// Accept-Ranges: bytes 时改用 Range: bytes=0-0 的 GET 请求，返回 206 即认为支持 Range，
+// 并从 Content-Range 中取得文件总大小。Accept-Ranges: none 时直接认为不支持。
+// resolved 为跟随重定向后最终响应的 URL，各分片直接请求该地址，不再各自重定向。
+// 两种请求都只读取响应头，响应体在返回前关闭，连接可被分片请求复用。
+func getInfoAndCheckRangeSupport(ctx context.Context, url string, o *options) (size int64, header http.Header, resolved string, err error) {
+	req, err := o.newRequest(ctx, "HEAD", url)
 	if err != nil {
 		return
 	}
-	// req.Header.Set("cookie", "")
+	req.Header.Set("Accept-Encoding", identityEncoding)
 	// log.Printf("Request header: %s\n", req.Header)
-	res, err := client.Do(req)
+	res, err := o.do(o.client, req)
+	if err != nil {
+		return
+	}
+	closeBody(res)
+	header = res.Header
+	resolved = res.Request.URL.String()
+	if err = o.checkETag(res); err != nil {
+		return
+	}
+	length := o.contentLength(header)
+	switch {
+	case res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented:
+		o.logger.Debug("head not allowed, trying range request", "status", res.Status)
+		return getInfoByRangeRequest(ctx, url, o)
+	case res.StatusCode >= 400:
+		// 部分签名链接只对 GET 有效，HEAD 会返回 403 等错误
+		o.logger.Debug("head failed, trying range request", "status", res.Status)
+		return getInfoByRangeRequest(ctx, url, o)
+	case length == "":
+		o.logger.Debug("head without size, trying range request", "status", res.Status)
+		return getInfoByRangeRequest(ctx, url, o)
+	}
+	size, err = strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return 0, header, resolved, fmt.Errorf("%w: invalid Content-Length: %v", errSizeUnknown, err)
+	}
+	if o.encoded(header) {
+		// 压缩后的响应无法按原始字节范围拼接
+		return size, header, resolved, fmt.Errorf("%w: response is encoded as %q", ErrRangeNotSupported, header.Get("Content-Encoding"))
+	}
+	if o.assumeRangeSupport {
+		return
+	}
+	switch accept_ranges := strings.ToLower(strings.TrimSpace(header.Get("Accept-Ranges"))); {
+	case accept_ranges == "bytes":
+		return
+	case accept_ranges == "none":
+		// 服务器明确表示不支持 Range
+		return size, header, resolved, fmt.Errorf("%w: `Accept-Ranges: none`", ErrRangeNotSupported)
+	case header.Get("Content-Range") != "":
+		return
+	}
+	// 很多服务器支持 Range 但不返回 Accept-Ranges，以实际的 Range 请求是否返回 206 为准
+	o.logger.Debug("head without `Accept-Ranges: bytes`, trying range request", "accept_ranges", header.Get("Accept-Ranges"))
+	return getInfoByRangeRequest(ctx, url, o)
+}
+
+// getInfoByRangeRequest 在 HEAD 不可用时发送只请求第一个字节的 GET 请求：
+// 返回 206 时从 Content-Range 中获取文件总大小，返回 200 时从 Content-Length 获取大小并返回 ErrRangeNotSupported。
+// 206 的 Content-Range 必须正好是请求的第一个字节，否则同样认为不支持。
+func getInfoByRangeRequest(ctx context.Context, url string, o *options) (size int64, header http.Header, resolved string, err error) {
+	req, err := o.newRequest(ctx, "GET", url)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	req.Header.Set("Accept-Encoding", identityEncoding)
+	res, err := o.do(o.client, req)
 	if err != nil {
 		return
 	}
+	// 只需要响应头，不读取数据
+	closeBody(res)
 	header = res.Header
-	_, have := header["Content-Length"]
-	if !have {
-		err = errors.New("get file size failed")
+	resolved = res.Request.URL.String()
+	if err = o.checkETag(res); err != nil {
 		return
 	}
-	size, err = strconv.ParseInt(header["Content-Length"][0], 10, 64)
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// 空文件无法满足 0-0，Content-Range 为 "bytes */0"
+		if v := strings.TrimPrefix(header.Get("Content-Range"), "bytes */"); v != header.Get("Content-Range") {
+			if size, err = strconv.ParseInt(v, 10, 64); err == nil {
+				return size, header, resolved, nil
+			}
+		}
+		return 0, header, resolved, fmt.Errorf("%w: %s", errSizeUnknown, res.Status)
+	}
+	if res.StatusCode >= 400 {
+		return 0, header, resolved, &StatusError{Code: res.StatusCode, Status: res.Status}
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		if length := o.contentLength(header); length != "" {
+			size, _ = strconv.ParseInt(length, 10, 64)
+		}
+		return size, header, resolved, fmt.Errorf("%w: %s", ErrRangeNotSupported, res.Status)
+	}
+	if o.encoded(header) {
+		return 0, header, resolved, fmt.Errorf("%w: response is encoded as %q", ErrRangeNotSupported, header.Get("Content-Encoding"))
+	}
+	crStart, crEnd, size, err := parseContentRange(header.Get("Content-Range"))
 	if err != nil {
-		return 0, header, fmt.Errorf("get file size error: %w", err)
+		return 0, header, resolved, fmt.Errorf("%w: %v", errSizeUnknown, err)
+	}
+	if crStart != 0 || crEnd != 0 {
+		// 返回的范围与请求的不一致，按该范围拼接分片会得到错误的文件
+		return 0, header, resolved, fmt.Errorf("%w: server responded `Content-Range: %s` to `Range: bytes=0-0`", ErrRangeNotSupported, header.Get("Content-Range"))
+	}
+	if size < 0 {
+		return 0, header, resolved, fmt.Errorf("%w: unknown total size in `Content-Range`", errSizeUnknown)
+	}
+	o.logger.Debug("range support detected by range request", "size", size, "accept_ranges", header.Get("Accept-Ranges"))
+	return size, header, resolved, nil
+}
+
+// rangeValidator 返回分片请求 If-Range 使用的校验值：优先使用强 ETag，否则使用 Last-Modified，
+// 使文件在下载途中变化时服务器返回整个文件而不是与旧内容拼接的分片。
+func rangeValidator(header http.Header) string {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// resolvedRejected 判断分片请求的失败是否表示重定向后的地址不能再用于 Range 请求。
+func resolvedRejected(err error) bool {
+	if errors.Is(err, ErrRangeNotSupported) || errors.Is(err, ErrURLExpired) {
+		return true
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		switch se.Code {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+			return true
+		}
+	}
+	return false
+}
+
+// maxDrainBytes 为关闭响应前最多读取丢弃的字节数，读完响应体的连接才能被复用。
+const maxDrainBytes = 64 << 10
+
+// closeBody 读取并丢弃少量剩余数据后关闭响应体，使连接可以复用。
+func closeBody(resp *http.Response) {
+	_, _ = io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+	resp.Body.Close()
+}
+
+// contentLength 返回 Content-Length，缺失时使用 WithSizeHeader 指定的头部。
+func (o *options) contentLength(header http.Header) string {
+	length := header.Get("Content-Length")
+	if length == "" && o.sizeHeader != "" {
+		length = header.Get(o.sizeHeader)
+	}
+	return length
+}
+
+// parseContentRange 解析形如 "bytes 0-99/1000" 的 Content-Range，总大小为 "*" 时 total 为 -1。
+func parseContentRange(v string) (start, end, total int64, err error) {
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	spec := strings.TrimPrefix(v, "bytes ")
+	rng, totalStr, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	total = -1
+	if totalStr != "*" {
+		if total, err = strconv.ParseInt(totalStr, 10, 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+		}
+	}
+	startStr, endStr, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
 	}
-	accept_ranges, supported := header["Accept-Ranges"]
-	if !supported {
-		return size, header, errors.New("doesn't support header `Accept-Ranges`")
-	} else if supported && accept_ranges[0] != "bytes" {
-		return size, header, errors.New("support `Accept-Ranges`, but value is not `bytes`")
+	if start, err = strconv.ParseInt(startStr, 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
 	}
-	return
+	if end, err = strconv.ParseInt(endStr, 10, 64); err != nil || end < start {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	return start, end, total, nil
 }
 
 func getFileNameFromUrl(download_url string) (string, error) {
@@ -226,8 +1044,12 @@ func getFileNameByHeader(header http.Header) string {
 	}
 	for k, v := range header {
 		if strings.Contains(strings.ToLower(k), "content-disposition") {
+			// 处理引号与 RFC 5987 的 filename*=UTF-8''... 编码
+			if _, params, err := mime.ParseMediaType(v[0]); err == nil && params["filename"] != "" {
+				return params["filename"]
+			}
 			if strings.Contains(v[0], "filename=") {
-				return v[0][strings.Index(v[0], "filename=")+9:]
+				return cutParam(v[0][strings.Index(v[0], "filename=")+9:])
 			} else {
 				return v[0]
 			}
@@ -240,3 +1062,39 @@ func getFileNameByHeader(header http.Header) string {
 	}
 	return ""
 }
+
+// cutParam 截取无法解析的 Content-Disposition 中 filename= 之后的值，去掉之后的其他参数。
+func cutParam(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "\"") {
+		if i := strings.Index(v[1:], "\""); i >= 0 {
+			return v[1 : i+1]
+		}
+		return v
+	}
+	if i := strings.Index(v, ";"); i >= 0 {
+		return v[:i]
+	}
+	return v
+}
+
+// sanitizeFileName 将服务器提供的文件名限制为不含目录的文件名：去掉引号与控制字符，
+// 只保留最后一个 / 或 \ 之后的部分，并按当前系统去掉不允许的字符(参见 sanitizeForOS)，
+// "."、".." 等无效的名字返回空字符串。
+func sanitizeFileName(name string) string {
+	name = strings.Trim(strings.TrimSpace(name), "\"' ")
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = sanitizeForOS(strings.TrimSpace(name))
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
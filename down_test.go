@@ -0,0 +1,321 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testContent 返回 n 字节内容不重复的测试数据，错位拼接能被发现。
+func testContent(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+// serveData 返回以 http.ServeContent 提供 data 的处理函数，支持 HEAD 与 Range。
+func serveData(data []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}
+}
+
+// newServer 启动测试服务器，测试结束时关闭。
+func newServer(t *testing.T, h http.Handler) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// checkFile 断言 path 的内容为 want。
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s: content mismatch, got %d bytes, want %d", path, len(got), len(want))
+	}
+}
+
+func TestIgnoreServerFilename(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="server.bin"`)
+		serveData(data)(w, r)
+	}))
+
+	dir := t.TempDir()
+	res, err := ParallelDownloadEx(s.URL+"/from-url.bin", dir, "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(res.Path); got != "server.bin" {
+		t.Fatalf("default name = %q, want server.bin", got)
+	}
+
+	res, err = ParallelDownloadEx(s.URL+"/from-url.bin", dir, "", 4, WithIgnoreServerFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(res.Path); got != "from-url.bin" {
+		t.Fatalf("name with WithIgnoreServerFilename = %q, want from-url.bin", got)
+	}
+	checkFile(t, res.Path, data)
+
+	res, err = ParallelDownloadEx(s.URL+"/from-url.bin", dir, "explicit.bin", 4, WithIgnoreServerFilename())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.Base(res.Path); got != "explicit.bin" {
+		t.Fatalf("explicit name = %q, want explicit.bin", got)
+	}
+}
+
+func TestExpectedMagicMismatch(t *testing.T) {
+	data := testContent(1 << 20)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		if r.Method == http.MethodGet && rng != "" && !strings.HasPrefix(rng, "bytes=0-") {
+			// 其余分片一直不结束，只有提前中止下载才能返回
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+
+	dir := t.TempDir()
+	done := make(chan error, 1)
+	go func() {
+		done <- ParallelDownload(s.URL+"/f.zip", dir, "", 4, WithExpectedMagic([]byte("PK")))
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrMagicMismatch) {
+			t.Fatalf("err = %v, want ErrMagicMismatch", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not abort on magic mismatch")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "f.zip")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("destination left behind: %v", err)
+	}
+
+	path := filepath.Join(dir, "ok.zip")
+	if err := ParallelDownload(s.URL+"/f.zip", dir, "ok.zip", 1, WithExpectedMagic(data[:2])); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, data)
+}
+
+func TestSizeHeader(t *testing.T) {
+	data := testContent(10000)
+	var probes atomic.Int32
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			if r.Header.Get("Range") == "bytes=0-0" {
+				probes.Add(1)
+			}
+			serveData(data)(w, r)
+			return
+		}
+		// 不带 Range 时以 chunked 编码响应，没有 Content-Length
+		size := strconv.Itoa(len(data))
+		if r.URL.Path == "/bad.bin" {
+			size = "12ab"
+		}
+		w.Header().Set("X-File-Size", size)
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}))
+
+	dir := t.TempDir()
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 3, WithSizeHeader("x-file-size"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Parallel || res.Size != int64(len(data)) {
+		t.Fatalf("parallel = %v, size = %d", res.Parallel, res.Size)
+	}
+	if n := probes.Load(); n != 0 {
+		t.Fatalf("%d range probes sent although the size header was present", n)
+	}
+	checkFile(t, res.Path, data)
+
+	res, err = ParallelDownloadEx(s.URL+"/bad.bin", dir, "", 3, WithSizeHeader("X-File-Size"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parallel || !errors.Is(res.FallbackReason, errSizeUnknown) {
+		t.Fatalf("invalid size header: parallel = %v, reason = %v", res.Parallel, res.FallbackReason)
+	}
+	checkFile(t, res.Path, data)
+}
+
+func TestHeadWithoutSize(t *testing.T) {
+	data := testContent(10000)
+	var rangeGets atomic.Int32
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			// 动态接口常见的 HEAD：200 但没有 Content-Length
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			return
+		}
+		if r.Header.Get("Range") == "bytes=0-0" {
+			rangeGets.Add(1)
+		}
+		serveData(data)(w, r)
+	}))
+
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rangeGets.Load() != 1 {
+		t.Fatalf("range probes = %d, want 1", rangeGets.Load())
+	}
+	if !res.Parallel || res.Size != int64(len(data)) {
+		t.Fatalf("parallel = %v, size = %d, reason = %v", res.Parallel, res.Size, res.FallbackReason)
+	}
+	checkFile(t, res.Path, data)
+}
+
+func TestAssumeRangeSupport(t *testing.T) {
+	data := testContent(10000)
+	var probes atomic.Int32
+	// 支持 Range 但不返回 Accept-Ranges 的服务器
+	ranged := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=0-0" {
+			probes.Add(1)
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	res, err := ParallelDownloadEx(ranged.URL+"/f.bin", t.TempDir(), "", 4, WithAssumeRangeSupport(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Load() != 0 {
+		t.Fatalf("%d range probes sent although range support was assumed", probes.Load())
+	}
+	if !res.Parallel {
+		t.Fatalf("not parallel: %v", res.FallbackReason)
+	}
+	checkFile(t, res.Path, data)
+
+	// 实际不支持 Range 的服务器返回 200，改为普通下载
+	plain := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}))
+	res, err = ParallelDownloadEx(plain.URL+"/f.bin", t.TempDir(), "", 4, WithAssumeRangeSupport(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parallel || !errors.Is(res.FallbackReason, ErrRangeNotSupported) {
+		t.Fatalf("parallel = %v, reason = %v", res.Parallel, res.FallbackReason)
+	}
+	checkFile(t, res.Path, data)
+}
+
+func TestUnstableContentLength(t *testing.T) {
+	data := testContent(10000)
+	var requests atomic.Int64
+	// 每次响应报告的总大小都不同，像是动态生成的内容
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		total := len(data) - int(requests.Add(1))
+		w.Header().Set("Accept-Ranges", "bytes")
+		rng := r.Header.Get("Range")
+		if rng == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(total))
+			return
+		}
+		var start, end int
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[start : end+1])
+	}))
+
+	dir := t.TempDir()
+	err := ParallelDownload(s.URL+"/f.bin", dir, "", 3)
+	if !errors.Is(err, ErrUnstableContent) {
+		t.Fatalf("err = %v, want ErrUnstableContent", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "f.bin")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unreliable file kept: %v", err)
+	}
+}
+
+func TestInfoProbeStages(t *testing.T) {
+	data := testContent(10000)
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		probes   int32 // Range: bytes=0-0 请求的次数
+		parallel bool
+	}{
+		{"head ok", serveData(data), 0, true},
+		{"head 405, probe ok", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			serveData(data)(w, r)
+		}, 1, true},
+		{"head 501, no range support", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			// 忽略 Range，总是返回整个文件
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data)
+		}, 1, false},
+	}
+	for _, tt := range tests {
+		var probes atomic.Int32
+		s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") == "bytes=0-0" {
+				probes.Add(1)
+			}
+			tt.handler(w, r)
+		}))
+		res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		checkFile(t, res.Path, data)
+		if probes.Load() != tt.probes || res.Parallel != tt.parallel {
+			t.Errorf("%s: probes = %d, parallel = %v (%v), want %d, %v", tt.name, probes.Load(), res.Parallel, res.FallbackReason, tt.probes, tt.parallel)
+		}
+		if !tt.parallel && (!errors.Is(res.FallbackReason, ErrRangeNotSupported) || res.Size != int64(len(data))) {
+			t.Errorf("%s: reason = %v, size = %d", tt.name, res.FallbackReason, res.Size)
+		}
+	}
+}
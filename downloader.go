@@ -0,0 +1,94 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+)
+
+// Downloader 保存一组共用的 Option(如 WithHTTPClient、WithHeader、WithUserAgent)，
+// 用同一配置下载多个文件。调用各方法时传入的 Option 在其后应用，可覆盖 Downloader 的配置。
+// 零值可直接使用，与包级函数的默认行为相同。
+type Downloader struct {
+	opts []Option
+}
+
+// NewDownloader 返回使用 opts 的 Downloader。
+func NewDownloader(opts ...Option) *Downloader {
+	return &Downloader{opts: append([]Option(nil), opts...)}
+}
+
+// options 将 Downloader 的配置与本次调用的 opts 合并。
+func (d *Downloader) options(opts []Option) *options {
+	return newOptions(append(d.opts[:len(d.opts):len(d.opts)], opts...))
+}
+
+// Download 单线程下载 url，参见 DownloadEx。
+func (d *Downloader) Download(url string, savePath string, filename string, opts ...Option) (*DownloadResult, error) {
+	return d.DownloadContext(context.Background(), url, savePath, filename, opts...)
+}
+
+// DownloadContext 单线程下载 url，参见 DownloadContext。
+func (d *Downloader) DownloadContext(ctx context.Context, url string, savePath string, filename string, opts ...Option) (*DownloadResult, error) {
+	o := d.options(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	err := canceledError(ctx, download(dctx, url, savePath, filename, o))
+	return o.finish(url, err), err
+}
+
+// ParallelDownload 多线程下载 url，参见 ParallelDownloadEx。
+func (d *Downloader) ParallelDownload(download_url string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return d.ParallelDownloadContext(context.Background(), download_url, savePath, filename, worker_count, opts...)
+}
+
+// ParallelDownloadContext 多线程下载 url，参见 ParallelDownloadContext。
+func (d *Downloader) ParallelDownloadContext(ctx context.Context, download_url string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	o := d.options(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	err := canceledError(ctx, parallelDownload(dctx, download_url, savePath, filename, worker_count, o))
+	return o.finish(download_url, err), err
+}
+
+// ParallelDownloadMirrors 从多个镜像多线程下载同一个文件，参见 ParallelDownloadMirrors。
+func (d *Downloader) ParallelDownloadMirrors(ctx context.Context, urls []string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no download url")
+	}
+	opts = append(opts[:len(opts):len(opts)], WithMirrors(urls[1:]...))
+	return d.ParallelDownloadContext(ctx, urls[0], savePath, filename, worker_count, opts...)
+}
+
+// Get 多线程下载 url，下载位置、线程数等通过 Option 设置，参见 Get。
+func (d *Downloader) Get(download_url string, opts ...Option) (*DownloadResult, error) {
+	o := d.options(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	parent := o.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := o.context(parent)
+	defer cancel()
+	err := canceledError(parent, parallelDownload(ctx, download_url, o.savePath, o.filename, 0, o))
+	return o.finish(download_url, err), err
+}
+
+// canceledError 在调用者的 ctx 结束导致下载失败时返回 ctx.Err()，
+// 使调用者可以直接与 context.Canceled 等比较。可以续传的超时仍返回 ErrTimeoutResumable。
+func canceledError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ErrTimeoutResumable) {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,99 @@
+package paralleldownload
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding 为开启 WithCompression 后单线程下载时声明支持的编码。
+const acceptEncoding = "br, zstd, gzip"
+
+// identityEncoding 为多线程下载各请求声明的编码，压缩的分片无法按原始字节范围拼接。
+const identityEncoding = "identity"
+
+// decodedLength 返回解码后响应体的长度，经过压缩或长度未知时为 -1。
+func decodedLength(resp *http.Response) int64 {
+	if len(contentEncodings(resp.Header)) > 0 {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// bodyLength 返回写入的响应体长度，WithKeepEncoded 时为未解码的长度。
+func (o *options) bodyLength(resp *http.Response) int64 {
+	if o.keepEncoded {
+		return resp.ContentLength
+	}
+	return decodedLength(resp)
+}
+
+// encoded 判断响应是否经过压缩且需要解码，WithKeepEncoded 时按原始字节处理，不算压缩。
+func (o *options) encoded(header http.Header) bool {
+	return !o.keepEncoded && len(contentEncodings(header)) > 0
+}
+
+// contentEncodings 返回响应的 Content-Encoding 列表，忽略 identity。
+func contentEncodings(header http.Header) []string {
+	var encodings []string
+	for _, v := range header.Values("Content-Encoding") {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e != "" && e != "identity" {
+				encodings = append(encodings, e)
+			}
+		}
+	}
+	return encodings
+}
+
+// decodeBody 按 Content-Encoding 逐层解码 body，返回的 ReadCloser 关闭时会释放解码器并关闭 body。
+func decodeBody(header http.Header, body io.ReadCloser) (io.ReadCloser, error) {
+	encodings := contentEncodings(header)
+	var r io.Reader = body
+	closers := []func(){func() { body.Close() }}
+	// 编码按应用顺序列出，需要倒序解码
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				body.Close()
+				return nil, fmt.Errorf("gzip decode error: %w", err)
+			}
+			closers = append(closers, func() { zr.Close() })
+			r = zr
+		case "br":
+			r = brotli.NewReader(r)
+		case "zstd":
+			zr, err := zstd.NewReader(r)
+			if err != nil {
+				body.Close()
+				return nil, fmt.Errorf("zstd decode error: %w", err)
+			}
+			closers = append(closers, zr.Close)
+			r = zr
+		default:
+			body.Close()
+			return nil, fmt.Errorf("unsupported Content-Encoding %q", encodings[i])
+		}
+	}
+	return &readCloser{Reader: r, close: closers}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close []func()
+}
+
+func (rc *readCloser) Close() error {
+	for i := len(rc.close) - 1; i >= 0; i-- {
+		rc.close[i]()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodedServer 在请求接受路径指定的编码时以该编码返回 data，否则返回原始内容。
+func encodedServer(t *testing.T, data []byte) string {
+	encoded := map[string][]byte{}
+	var buf bytes.Buffer
+	bw := brotli.NewWriter(&buf)
+	bw.Write(data)
+	bw.Close()
+	encoded["br"] = append([]byte(nil), buf.Bytes()...)
+	buf.Reset()
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(data)
+	zw.Close()
+	encoded["zstd"] = append([]byte(nil), buf.Bytes()...)
+	buf.Reset()
+	gw := gzip.NewWriter(&buf)
+	gw.Write(data)
+	gw.Close()
+	encoded["gzip"] = append([]byte(nil), buf.Bytes()...)
+
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".txt")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), enc) {
+			serveData(data)(w, r)
+			return
+		}
+		body := encoded[enc]
+		w.Header().Set("Content-Encoding", enc)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	}))
+	return s.URL
+}
+
+func TestCompressedSingleStream(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible text "), 5000)
+	url := encodedServer(t, data)
+	for _, enc := range []string{"br", "zstd", "gzip"} {
+		dir := t.TempDir()
+		res, err := DownloadEx(url+"/"+enc+".txt", dir, "", WithCompression())
+		if err != nil {
+			t.Fatalf("%s: %v", enc, err)
+		}
+		checkFile(t, filepath.Join(dir, enc+".txt"), data)
+		if res.Size != int64(len(data)) {
+			t.Fatalf("%s: size = %d, want decoded size %d", enc, res.Size, len(data))
+		}
+	}
+}
+
+func TestCompressionKeepsPartsUnencoded(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible text "), 5000)
+	url := encodedServer(t, data)
+	// 多线程下载的请求声明 identity，服务器不会压缩各分片
+	res, err := ParallelDownloadEx(url+"/br.txt", t.TempDir(), "", 4, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Parallel {
+		t.Fatalf("not parallel: %v", res.FallbackReason)
+	}
+	checkFile(t, res.Path, data)
+}
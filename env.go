@@ -0,0 +1,81 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 以下环境变量用于配置默认行为，显式传入的参数与 Option 优先于环境变量。
+const (
+	// EnvWorkers 为 worker_count <= 0 时使用的最大线程数。
+	EnvWorkers = "PARALLELDOWNLOAD_WORKERS"
+	// EnvRateLimit 为默认的总下载速度上限，单位为字节/秒，可带 K、M、G 后缀(按 1024 计)。
+	EnvRateLimit = "PARALLELDOWNLOAD_RATE_LIMIT"
+	// EnvUserAgent 为默认的 User-Agent。
+	EnvUserAgent = "PARALLELDOWNLOAD_UA"
+	// EnvChunkSize 为默认的分块大小(参见 WithChunkSize)，可带 K、M、G 后缀。
+	EnvChunkSize = "PARALLELDOWNLOAD_CHUNK_SIZE"
+)
+
+// applyEnv 从环境变量读取默认配置，无效的值会被忽略并返回说明。
+func applyEnv(o *options) (invalid []string) {
+	if v := os.Getenv(EnvWorkers); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", EnvWorkers, v))
+		} else {
+			o.workers = n
+		}
+	}
+	if v := os.Getenv(EnvRateLimit); v != "" {
+		n, err := parseByteSize(v)
+		if err != nil || n <= 0 {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", EnvRateLimit, v))
+		} else {
+			o.rateLimit = n
+		}
+	}
+	if v := os.Getenv(EnvUserAgent); v != "" {
+		o.userAgent = v
+	}
+	if v := os.Getenv(EnvChunkSize); v != "" {
+		n, err := parseByteSize(v)
+		if err != nil || n <= 0 {
+			invalid = append(invalid, fmt.Sprintf("%s=%q", EnvChunkSize, v))
+		} else {
+			o.chunkSize = n
+		}
+	}
+	return invalid
+}
+
+// parseByteSize 解析形如 "512"、"64K"、"1.5M"、"2G" 的字节数。
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	s = strings.TrimSuffix(s, "B")
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	// ParseFloat 接受 "Inf"、"NaN" 与 "1e30"，转换为 int64 前检查范围
+	n := f * unit
+	if math.IsNaN(n) || n < 0 || n >= math.MaxInt64 {
+		return 0, fmt.Errorf("byte size %q out of range", s)
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,82 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestEnvConfig(t *testing.T) {
+	t.Setenv(EnvWorkers, "3")
+	t.Setenv(EnvRateLimit, "2M")
+	t.Setenv(EnvUserAgent, "env-agent/1.0")
+	t.Setenv(EnvChunkSize, "64K")
+
+	o := newOptions(nil)
+	if o.workers != 3 || o.rateLimit != 2<<20 || o.userAgent != "env-agent/1.0" || o.chunkSize != 64<<10 {
+		t.Fatalf("workers = %d, rate limit = %d, user agent = %q, chunk size = %d", o.workers, o.rateLimit, o.userAgent, o.chunkSize)
+	}
+
+	// 显式的 Option 优先
+	o = newOptions([]Option{WithWorkers(5), WithRateLimit(100), WithUserAgent("explicit"), WithChunkSize(1 << 20)})
+	if o.workers != 5 || o.rateLimit != 100 || o.userAgent != "explicit" || o.chunkSize != 1<<20 {
+		t.Fatalf("options did not override env: workers = %d, rate limit = %d, user agent = %q, chunk size = %d", o.workers, o.rateLimit, o.userAgent, o.chunkSize)
+	}
+
+	data := testContent(10000)
+	var agents atomic.Int32
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() == "env-agent/1.0" {
+			agents.Add(1)
+		}
+		serveData(data)(w, r)
+	}))
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if agents.Load() == 0 {
+		t.Fatal("requests did not use the user agent from the environment")
+	}
+}
+
+func TestEnvConfigInvalid(t *testing.T) {
+	t.Setenv(EnvWorkers, "many")
+	t.Setenv(EnvRateLimit, "Inf")
+	t.Setenv(EnvChunkSize, "1e30")
+	logger := &recordLogger{}
+	o := newOptions([]Option{WithLogger(logger)})
+	if o.workers != defaultWorkers || o.rateLimit != 0 || o.chunkSize != 0 {
+		t.Fatalf("invalid env applied: workers = %d, rate limit = %d, chunk size = %d", o.workers, o.rateLimit, o.chunkSize)
+	}
+	var warnings int
+	for _, e := range logger.entries {
+		if e.msg == "ignore invalid environment variable" {
+			warnings++
+		}
+	}
+	if warnings != 3 {
+		t.Fatalf("got %d warnings, want 3", warnings)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	valid := map[string]int64{
+		"512":  512,
+		"64K":  64 << 10,
+		"64kb": 64 << 10,
+		"1.5M": 3 << 19,
+		"2G":   2 << 30,
+	}
+	for s, want := range valid {
+		if got, err := parseByteSize(s); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "abc", "Inf", "-Inf", "NaN", "1e30", "1e19", "9E9G", "-1K"} {
+		if got, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) = %d, want error", s, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	// estimateSampleSize 为测量带宽时下载的字节数。
+	estimateSampleSize = 1 << 20
+	// estimateRTTSamples 为测量延迟的请求次数，取最小值。
+	estimateRTTSamples = 3
+	// assumedWindow 为估算时假定的单个连接在途数据量(接收窗口)。
+	assumedWindow = 256 << 10
+	// maxSuggestedWorkers 为建议线程数的上限。
+	maxSuggestedWorkers = 32
+)
+
+// NetworkEstimate 为 EstimateWorkers 的测量结果。
+type NetworkEstimate struct {
+	// RTT 为多次请求中最短的首字节时间。
+	RTT time.Duration
+	// Bandwidth 为单个连接的传输速度，单位为字节/秒。
+	Bandwidth float64
+	// Workers 为建议的线程数。
+	Workers int64
+}
+
+// EstimateWorkers 对 url 做一次简短的延迟与带宽测量，按带宽时延积给出建议的线程数。
+// 单个连接的吞吐受接收窗口限制(约为 窗口/RTT)，高延迟链路需要更多连接才能跑满带宽，
+// 因此建议值为 带宽×RTT/窗口，范围为 [1, 32]。结果仅供参考，可以直接传给 ParallelDownload。
+func EstimateWorkers(url string, opts ...Option) (*NetworkEstimate, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	var rtt time.Duration
+	for i := 0; i < estimateRTTSamples; i++ {
+		d, err := measureFirstByte(url, o)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 || d < rtt {
+			rtt = d
+		}
+	}
+	bandwidth, err := measureBandwidth(url, o)
+	if err != nil {
+		return nil, err
+	}
+	return &NetworkEstimate{
+		RTT:       rtt,
+		Bandwidth: bandwidth,
+		Workers:   WorkersForBDP(bandwidth, rtt),
+	}, nil
+}
+
+// WorkersForBDP 根据单个连接的带宽(字节/秒)与 RTT 计算建议的线程数。
+func WorkersForBDP(bandwidth float64, rtt time.Duration) int64 {
+	n := int64(math.Ceil(bandwidth * rtt.Seconds() / assumedWindow))
+	if n < 1 {
+		n = 1
+	}
+	if n > maxSuggestedWorkers {
+		n = maxSuggestedWorkers
+	}
+	return n
+}
+
+// measureFirstByte 请求 1 个字节，返回收到响应头所用的时间。
+func measureFirstByte(url string, o *options) (time.Duration, error) {
+	req, err := o.newRequest(context.Background(), "GET", url)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	start := time.Now()
+	resp, err := o.do(o.client, req)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Since(start)
+	// 读完 1 字节的响应体以便复用连接；不支持 Range 时直接关闭
+	if resp.StatusCode == 206 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	return d, nil
+}
+
+// measureBandwidth 下载最多 estimateSampleSize 字节，按首字节之后的时间计算单连接速度。
+func measureBandwidth(url string, o *options) (float64, error) {
+	req, err := o.newRequest(context.Background(), "GET", url)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", estimateSampleSize-1))
+	resp, err := o.do(o.client, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, estimateSampleSize))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if n == 0 {
+		return 0, errors.New("no data received")
+	}
+	if elapsed <= 0 {
+		elapsed = time.Microsecond
+	}
+	return float64(n) / elapsed.Seconds(), nil
+}
@@ -0,0 +1,66 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// throttledReader 每读取 chunk 字节等待 1ms，限制服务器的发送速度。
+type throttledReader struct {
+	*bytes.Reader
+	chunk int
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	time.Sleep(time.Millisecond)
+	return r.Reader.Read(p)
+}
+
+func TestWorkersForBDP(t *testing.T) {
+	tests := []struct {
+		bandwidth float64
+		rtt       time.Duration
+		want      int64
+	}{
+		{0, 0, 1},
+		{10 << 20, time.Millisecond, 1},
+		{10 << 20, 100 * time.Millisecond, 4},
+		{10 << 20, 200 * time.Millisecond, 8},
+		{1 << 30, time.Second, maxSuggestedWorkers},
+	}
+	for _, tt := range tests {
+		if got := WorkersForBDP(tt.bandwidth, tt.rtt); got != tt.want {
+			t.Errorf("WorkersForBDP(%v, %v) = %d, want %d", tt.bandwidth, tt.rtt, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateWorkersScalesWithLatency(t *testing.T) {
+	data := testContent(2 << 20)
+	estimate := func(latency time.Duration) *NetworkEstimate {
+		s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(latency)
+			// 约 8 MB/s
+			http.ServeContent(w, r, "", time.Time{}, throttledReader{bytes.NewReader(data), 8 << 10})
+		}))
+		e, err := EstimateWorkers(s.URL + "/f.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.RTT < latency {
+			t.Fatalf("RTT %v below the simulated latency %v", e.RTT, latency)
+		}
+		return e
+	}
+	low := estimate(0)
+	high := estimate(300 * time.Millisecond)
+	t.Logf("low latency: %+v, high latency: %+v", low, high)
+	if high.Workers <= low.Workers {
+		t.Fatalf("suggestion did not grow with latency: %d at %v, %d at %v", low.Workers, low.RTT, high.Workers, high.RTT)
+	}
+}
@@ -0,0 +1,207 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType 为 Event 的类型。
+type EventType int
+
+const (
+	// DownloadStarted 表示开始下载。
+	DownloadStarted EventType = iota
+	// ProbeCompleted 表示已获取文件信息：Size 为文件大小，RangeSupported 表示是否多线程下载，
+	// 不能多线程下载时 Err 为原因。
+	ProbeCompleted
+	// ChunkStarted 表示开始下载一个分片，单线程下载时为分片 0，文件大小未知时 End 为 -1。
+	ChunkStarted
+	// ChunkRetried 表示分片失败后从 Start 处重试，Attempt 为第几次重试，Err 为失败的原因。
+	ChunkRetried
+	// ChunkCompleted 表示分片结束，Bytes 为写入的字节数，Err 不为 nil 表示分片失败。
+	ChunkCompleted
+	// DownloadCompleted 表示下载成功，是最后一个事件。
+	DownloadCompleted
+	// DownloadFailed 表示下载失败，是最后一个事件，Err 为失败的原因。
+	DownloadFailed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case DownloadStarted:
+		return "download_started"
+	case ProbeCompleted:
+		return "probe_completed"
+	case ChunkStarted:
+		return "chunk_started"
+	case ChunkRetried:
+		return "chunk_retried"
+	case ChunkCompleted:
+		return "chunk_completed"
+	case DownloadCompleted:
+		return "download_completed"
+	case DownloadFailed:
+		return "download_failed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event 为下载过程中的一个事件，参见 WithEvents。各字段只在对应的事件类型中有效。
+type Event struct {
+	Type EventType
+	Time time.Time
+	URL  string
+	// Size 为文件大小，未知时为 -1
+	Size           int64
+	RangeSupported bool
+	// Part、Start、End 为分片的编号与范围，End 包含在内
+	Part  int64
+	Start int64
+	End   int64
+	// Bytes 为分片写入的字节数，DownloadCompleted 与 DownloadFailed 时为整个文件写入的字节数
+	Bytes   int64
+	Attempt int
+	Err     error
+	// Result 为 DownloadCompleted 与 DownloadFailed 的下载结果
+	Result *DownloadResult
+}
+
+// eventStream 将事件放入队列，由后台 goroutine 按顺序发送到 ch，接收慢时不影响下载。
+type eventStream struct {
+	ch     chan<- Event
+	mu     sync.Mutex
+	url    string
+	probed bool
+	size   int64
+	reason error // 回退到单线程下载的原因
+	queue  []Event
+	closed bool
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// startEvents 在设置了 WithEvents 时开始发送事件。
+func (o *options) startEvents() {
+	if o.events == nil {
+		return
+	}
+	s := &eventStream{ch: o.events, size: -1, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	o.emitter = s
+	go s.run()
+}
+
+func (s *eventStream) run() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		queue, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+		for _, e := range queue {
+			s.ch <- e
+		}
+		if closed {
+			return
+		}
+		<-s.notify
+	}
+}
+
+func (s *eventStream) emit(e Event) {
+	if s == nil {
+		return
+	}
+	e.Time = time.Now()
+	s.mu.Lock()
+	if e.URL == "" {
+		e.URL = s.url
+	}
+	s.queue = append(s.queue, e)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// start 发送 DownloadStarted，回退到单线程下载时不重复发送。
+func (s *eventStream) start(url string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	started := s.url != ""
+	if !started {
+		s.url = url
+	}
+	s.mu.Unlock()
+	if !started {
+		s.emit(Event{Type: DownloadStarted, URL: url})
+	}
+}
+
+// unranged 记录不能多线程下载的原因，由回退的单线程下载发送 ProbeCompleted。
+func (s *eventStream) unranged(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.reason = err
+	s.mu.Unlock()
+}
+
+// probe 发送 ProbeCompleted，只发送第一次获取到的文件信息。
+func (s *eventStream) probe(size int64, ranged bool, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	probed := s.probed
+	if !probed {
+		s.probed, s.size = true, size
+	}
+	if err == nil && !ranged {
+		err = s.reason
+	}
+	s.mu.Unlock()
+	if !probed {
+		s.emit(Event{Type: ProbeCompleted, Size: size, RangeSupported: ranged, Err: err})
+	}
+}
+
+// streamPart 返回单线程下载对应的分片 0，size 未知时 End 为 -1。
+func streamPart(size int64) part {
+	if size < 0 {
+		return part{end: -1}
+	}
+	return part{end: size - 1}
+}
+
+func (s *eventStream) part(t EventType, p part, written int64, err error) {
+	s.emit(Event{Type: t, Part: p.num, Start: p.start, End: p.end, Bytes: written, Err: err})
+}
+
+// close 发送最后一个事件并等待所有事件发送完。
+func (s *eventStream) close(url string, res *DownloadResult, err error) {
+	if s == nil {
+		return
+	}
+	s.start(url)
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+	e := Event{Type: DownloadCompleted, URL: url, Size: size, Bytes: res.Size, Err: err, Result: res}
+	if err != nil {
+		e.Type = DownloadFailed
+	}
+	s.emit(e)
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	<-s.done
+}
@@ -0,0 +1,157 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// collectEvents 返回 WithEvents 使用的 channel，wait 在下载返回后调用，返回收到的所有事件。
+func collectEvents() (ch chan Event, wait func() []Event) {
+	ch = make(chan Event)
+	var events []Event
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for e := range ch {
+			events = append(events, e)
+		}
+	}()
+	return ch, func() []Event {
+		close(ch)
+		wg.Wait()
+		return events
+	}
+}
+
+// checkEventOrder 检查事件的顺序：第一个为 DownloadStarted，最后一个为 last，
+// 每个分片先开始再结束，结束后不再有该分片的事件。
+func checkEventOrder(t *testing.T, events []Event, last EventType) {
+	t.Helper()
+	if len(events) < 2 || events[0].Type != DownloadStarted {
+		t.Fatalf("events = %v, want DownloadStarted first", events)
+	}
+	if got := events[len(events)-1].Type; got != last {
+		t.Fatalf("last event %v, want %v", got, last)
+	}
+	probed := false
+	started, completed := map[int64]bool{}, map[int64]bool{}
+	for i, e := range events {
+		switch e.Type {
+		case DownloadStarted:
+			if i != 0 {
+				t.Fatalf("DownloadStarted sent again at %d", i)
+			}
+		case ProbeCompleted:
+			if probed {
+				t.Fatal("ProbeCompleted sent twice")
+			}
+			probed = true
+		case ChunkStarted, ChunkRetried, ChunkCompleted:
+			if !probed {
+				t.Fatalf("%v of part %d before ProbeCompleted", e.Type, e.Part)
+			}
+			if completed[e.Part] {
+				t.Fatalf("%v of part %d after it completed", e.Type, e.Part)
+			}
+			if e.Type != ChunkStarted && !started[e.Part] {
+				t.Fatalf("%v of part %d before it started", e.Type, e.Part)
+			}
+			started[e.Part] = true
+			completed[e.Part] = e.Type == ChunkCompleted
+		case DownloadCompleted, DownloadFailed:
+			if i != len(events)-1 {
+				t.Fatalf("%v at %d is not the last event", e.Type, i)
+			}
+		}
+	}
+	for num := range started {
+		if !completed[num] {
+			t.Fatalf("part %d never completed", num)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	ch, wait := collectEvents()
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithEvents(ch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := wait()
+	checkEventOrder(t, events, DownloadCompleted)
+
+	var parts, written int64
+	for _, e := range events {
+		if e.URL != s.URL+"/f.bin" {
+			t.Fatalf("%v has URL %q", e.Type, e.URL)
+		}
+		switch e.Type {
+		case ProbeCompleted:
+			if e.Size != int64(len(data)) || !e.RangeSupported || e.Err != nil {
+				t.Fatalf("probe event %+v", e)
+			}
+		case ChunkCompleted:
+			if e.Err != nil || e.Bytes != e.End-e.Start+1 {
+				t.Fatalf("chunk event %+v", e)
+			}
+			parts++
+			written += e.Bytes
+		}
+	}
+	if parts != 4 || written != int64(len(data)) {
+		t.Fatalf("%d parts wrote %d bytes", parts, written)
+	}
+	last := events[len(events)-1]
+	if last.Result != res || last.Bytes != int64(len(data)) || last.Size != int64(len(data)) {
+		t.Fatalf("completed event %+v", last)
+	}
+}
+
+func TestEventsFallback(t *testing.T) {
+	data := testContent(10000)
+	// 不支持 Range 的服务器回退到单线程下载
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	ch, wait := collectEvents()
+	if _, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithEvents(ch)); err != nil {
+		t.Fatal(err)
+	}
+	events := wait()
+	checkEventOrder(t, events, DownloadCompleted)
+	var chunks int
+	for _, e := range events {
+		switch e.Type {
+		case ProbeCompleted:
+			if e.RangeSupported || e.Err == nil {
+				t.Fatalf("probe event %+v, want the fallback reason", e)
+			}
+		case ChunkStarted:
+			chunks++
+			if e.Part != 0 || e.Start != 0 {
+				t.Fatalf("stream chunk event %+v", e)
+			}
+		}
+	}
+	if chunks != 1 {
+		t.Fatalf("%d chunks started, want 1", chunks)
+	}
+}
+
+func TestEventsFailed(t *testing.T) {
+	s := newServer(t, http.NotFoundHandler())
+	ch, wait := collectEvents()
+	_, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithEvents(ch))
+	if err == nil {
+		t.Fatal("download of a missing file succeeded")
+	}
+	events := wait()
+	checkEventOrder(t, events, DownloadFailed)
+	if last := events[len(events)-1]; last.Err == nil || last.Err.Error() != err.Error() {
+		t.Fatalf("failed event err = %v, want %v", last.Err, err)
+	}
+}
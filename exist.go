@@ -0,0 +1,203 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrFileExists 表示保存路径已经存在文件，且设置了 ExistError。
+var ErrFileExists = errors.New("destination already exists")
+
+// errSkipExisting 表示保存路径已经存在文件且设置了 ExistSkip，下载直接成功返回。
+var errSkipExisting = errors.New("skip existing destination")
+
+// ExistPolicy 决定保存路径已经存在文件时的处理方式，按最终确定的文件名(包括从响应头得到的)判断。
+type ExistPolicy int
+
+const (
+	// ExistOverwrite 覆盖已有的文件(默认)。
+	ExistOverwrite ExistPolicy = iota
+	// ExistSkip 不下载，直接返回 nil，DownloadResult.Skipped 为 true。
+	ExistSkip
+	// ExistError 不下载，返回 ErrFileExists。
+	ExistError
+	// ExistRename 保存为不存在的 "name (1).ext"、"name (2).ext" 等。
+	ExistRename
+	// ExistUpdate 在已有的文件与远程文件相同时不下载，DownloadResult.UpToDate 与 Skipped 为 true，否则重新下载并覆盖。
+	// 大小一致时以上次下载时记录的 ETag(If-None-Match)与文件的修改时间(If-Modified-Since)发送条件请求，
+	// 服务器返回 304 视为相同；忽略条件请求的服务器按 ETag 相同(没有 ETag 时 Last-Modified 不晚于文件的修改时间)判断。
+	// 下载完成后 ETag 记录在 "name.etag" 中，文件的修改时间设为 Last-Modified。
+	ExistUpdate
+)
+
+// maxRenameAttempts 为 ExistRename 最多尝试的编号。
+const maxRenameAttempts = 10000
+
+// etagSuffix 为记录下载时 ETag 的文件后缀，参见 ExistUpdate。
+const etagSuffix = ".etag"
+
+func (p ExistPolicy) String() string {
+	switch p {
+	case ExistOverwrite:
+		return "overwrite"
+	case ExistSkip:
+		return "skip"
+	case ExistError:
+		return "error"
+	case ExistRename:
+		return "rename"
+	case ExistUpdate:
+		return "update"
+	}
+	return fmt.Sprintf("ExistPolicy(%d)", int(p))
+}
+
+// checkExisting 在创建或截断 path 之前按 existPolicy 检查 path 是否已经存在，返回实际使用的路径。
+func (o *options) checkExisting(ctx context.Context, path string, info FileInfo) (string, error) {
+	if o.existPolicy == ExistOverwrite {
+		return path, nil
+	}
+	if o.existPolicy == ExistUpdate {
+		return path, o.checkUpdate(ctx, path, info)
+	}
+	if exists, err := o.pathExists(path); err != nil || !exists {
+		return path, err
+	}
+	switch o.existPolicy {
+	case ExistSkip:
+		o.logger.Info("destination exists, skip download", "path", path)
+		o.skipped = true
+		return path, errSkipExisting
+	case ExistRename:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; i <= maxRenameAttempts; i++ {
+			renamed := fmt.Sprintf("%s (%d)%s", base, i, ext)
+			exists, err := o.pathExists(renamed)
+			if err != nil {
+				return path, err
+			}
+			if !exists {
+				o.logger.Info("destination exists, renamed", "path", path, "renamed", renamed)
+				return renamed, nil
+			}
+		}
+	}
+	return path, fmt.Errorf("%w: %s", ErrFileExists, path)
+}
+
+// checkUpdate 实现 ExistUpdate：path 与远程文件相同时跳过下载，否则记下远程文件的版本，下载完成后写入。
+func (o *options) checkUpdate(ctx context.Context, path string, info FileInfo) error {
+	fsys := o.fsys()
+	local, err := fsys.Stat(path)
+	if err == nil && local.Mode().IsRegular() && (info.Size < 0 || info.Size == local.Size()) {
+		etag := localETag(fsys, path)
+		header, notModified := o.conditionalHead(ctx, info.FinalURL, etag, local.ModTime())
+		if header == nil {
+			// 条件请求失败时按获取文件信息时的响应头判断
+			header = info.Header
+		}
+		if notModified || unchanged(local, etag, info.Size, header) {
+			o.logger.Info("destination up to date, skip download", "path", path)
+			o.skipped, o.upToDate = true, true
+			return errSkipExisting
+		}
+	}
+	o.version = info.Header
+	return nil
+}
+
+// conditionalHead 以 If-None-Match: etag(不为空时)与 If-Modified-Since: modified 请求 url 的 HEAD，
+// 返回 304 时 notModified 为 true，请求失败或返回错误状态时 header 为 nil。
+func (o *options) conditionalHead(ctx context.Context, url string, etag string, modified time.Time) (header http.Header, notModified bool) {
+	req, err := o.newRequest(ctx, http.MethodHead, url)
+	if err != nil {
+		return nil, false
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	req.Header.Set("If-Modified-Since", modified.UTC().Format(http.TimeFormat))
+	resp, err := o.do(o.client, req)
+	if err != nil {
+		o.logger.Debug("conditional request failed", "url", url, "err", err)
+		return nil, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return resp.Header, true
+	}
+	if resp.StatusCode >= 300 {
+		return nil, false
+	}
+	return resp.Header, false
+}
+
+// unchanged 判断本地文件 local 与响应头为 header、大小为 size(未知时为 -1)的远程文件是否相同。
+// etag 为上次下载时记录的 ETag，与远程的 ETag 有一个为空时改为比较 Last-Modified。
+func unchanged(local os.FileInfo, etag string, size int64, header http.Header) bool {
+	if size >= 0 && size != local.Size() {
+		return false
+	}
+	if remote := header.Get("ETag"); etag != "" && remote != "" {
+		return remote == etag
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	// HTTP 日期只精确到秒
+	return !modified.After(local.ModTime().Truncate(time.Second))
+}
+
+// localETag 返回上次下载 path 时记录的 ETag，没有记录时为空。
+func localETag(fsys FS, path string) string {
+	data, err := readFile(fsys, path+etagSuffix)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// recordVersion 在下载完成后记录远程文件的版本：ETag 写入 path.etag，修改时间设为 Last-Modified。
+func (o *options) recordVersion(path string, header http.Header) {
+	fsys := o.fsys()
+	if etag := header.Get("ETag"); etag != "" {
+		if err := writeFileAtomic(fsys, path+etagSuffix, []byte(etag)); err != nil {
+			o.logger.Warn("save etag failed", "path", path, "err", err)
+		}
+	} else if err := fsys.Remove(path + etagSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		o.logger.Warn("remove stale etag failed", "path", path, "err", err)
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return
+	}
+	if c, ok := fsys.(chtimesFS); ok {
+		if err := c.Chtimes(path, time.Now(), modified); err != nil {
+			o.logger.Warn("set modification time failed", "path", path, "err", err)
+		}
+	}
+}
+
+// pathExists 判断 path 是否存在，本地文件系统上不跟随符号链接。
+func (o *options) pathExists(path string) (bool, error) {
+	stat := o.fsys().Stat
+	if o.fs == nil {
+		stat = os.Lstat
+	}
+	if _, err := stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// taggedServer 提供可以更换内容的文件，etag 与 modified 为空或零值时不发送对应的响应头。
+type taggedServer struct {
+	mu              sync.Mutex
+	data            []byte
+	etag            string
+	modified        time.Time
+	gets            atomic.Int32
+	notModified     atomic.Int32
+	ifNoneMatch     atomic.Value
+	ifModifiedSince atomic.Bool
+}
+
+func (s *taggedServer) set(data []byte, etag string, modified time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data, s.etag, s.modified = data, etag, modified
+}
+
+func (s *taggedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, etag, modified := s.data, s.etag, s.modified
+	s.mu.Unlock()
+	if r.Method == http.MethodGet {
+		s.gets.Add(1)
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		s.ifNoneMatch.Store(v)
+	}
+	if r.Header.Get("If-Modified-Since") != "" {
+		s.ifModifiedSince.Store(true)
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(rec, r, "", modified, bytes.NewReader(data))
+	if rec.status == http.StatusNotModified {
+		s.notModified.Add(1)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func TestExistUpdate(t *testing.T) {
+	v1 := testContent(10000)
+	v2 := append([]byte(nil), v1...)
+	v2[5000] ^= 0xff
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		etag     string
+		modified time.Time
+		// 内容不变时第二次下载是否跳过
+		reuse bool
+	}{
+		{"etag", `"v1"`, time.Time{}, true},
+		{"last-modified", "", modified, true},
+		{"etag and last-modified", `"v1"`, modified, true},
+		{"no validator", "", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		srv := &taggedServer{}
+		srv.set(v1, tt.etag, tt.modified)
+		s := newServer(t, srv)
+		dir := t.TempDir()
+		path := filepath.Join(dir, "f.bin")
+		update := WithExistPolicy(ExistUpdate)
+
+		res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		checkFile(t, path, v1)
+		if res.UpToDate {
+			t.Fatalf("%s: missing file reported up to date", tt.name)
+		}
+
+		// 内容不变
+		srv.gets.Store(0)
+		res, err = ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.UpToDate != tt.reuse || res.Skipped != tt.reuse {
+			t.Fatalf("%s: unchanged file: up to date = %v, skipped = %v", tt.name, res.UpToDate, res.Skipped)
+		}
+		if tt.reuse {
+			if srv.notModified.Load() == 0 || !srv.ifModifiedSince.Load() {
+				t.Fatalf("%s: no conditional request answered with 304", tt.name)
+			}
+			if tt.etag != "" && srv.ifNoneMatch.Load() != tt.etag {
+				t.Fatalf("%s: If-None-Match = %v, want %s", tt.name, srv.ifNoneMatch.Load(), tt.etag)
+			}
+			// HEAD 与 Range 探测之外没有下载内容
+			if n := srv.gets.Load(); n > 1 {
+				t.Fatalf("%s: %d GET requests for an unchanged file", tt.name, n)
+			}
+		}
+		checkFile(t, path, v1)
+
+		// 远程文件已更新，大小不变
+		etag := tt.etag
+		if etag != "" {
+			etag = `"v2"`
+		}
+		mod := tt.modified
+		if !mod.IsZero() {
+			mod = mod.Add(time.Hour)
+		}
+		srv.set(v2, etag, mod)
+		res, err = ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, update)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if res.UpToDate {
+			t.Fatalf("%s: changed file reported up to date", tt.name)
+		}
+		checkFile(t, path, v2)
+		recorded, _ := os.ReadFile(path + etagSuffix)
+		if string(recorded) != etag {
+			t.Fatalf("%s: recorded etag %q, want %q", tt.name, recorded, etag)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package paralleldownload
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFallbackDisabled 表示无法多线程下载，且 WithFallbackPolicy 不允许回退到单线程下载。
+var ErrFallbackDisabled = errors.New("single-stream fallback disabled")
+
+// errSizeUnknown 表示获取不到文件大小，无法分片。
+var errSizeUnknown = errors.New("file size unknown")
+
+// FallbackPolicy 决定无法多线程下载时是否回退到单线程下载。
+type FallbackPolicy int
+
+const (
+	// FallbackAlways 获取文件信息失败或多线程下载被服务器拒绝时都回退到单线程下载(默认)。
+	FallbackAlways FallbackPolicy = iota
+	// FallbackRangeUnsupported 只在服务器不支持 Range 或没有给出文件大小时回退，
+	// 超时、403 等单线程下载同样会失败的错误直接返回。
+	FallbackRangeUnsupported
+	// FallbackNever 不回退，无法多线程下载时返回 ErrFallbackDisabled。
+	FallbackNever
+)
+
+func (p FallbackPolicy) String() string {
+	switch p {
+	case FallbackAlways:
+		return "always"
+	case FallbackRangeUnsupported:
+		return "range_unsupported"
+	case FallbackNever:
+		return "never"
+	}
+	return fmt.Sprintf("FallbackPolicy(%d)", int(p))
+}
+
+// rangeUnsupported 判断获取文件信息的错误是否只说明无法分片，单线程下载仍然可能成功。
+func rangeUnsupported(err error) bool {
+	return errors.Is(err, ErrRangeNotSupported) || errors.Is(err, errSizeUnknown)
+}
+
+// fallback 按 WithFallbackPolicy 判断因 reason 无法多线程下载时能否回退到单线程下载，
+// unsupported 表示 reason 说明服务器不支持分片。允许时记录原因(DownloadResult.Fallback)并返回 nil。
+func (o *options) fallback(reason error, unsupported bool) error {
+	switch {
+	case o.fallbackPolicy == FallbackNever:
+		return &fallbackDisabledError{reason: reason}
+	case o.fallbackPolicy == FallbackRangeUnsupported && !unsupported:
+		return reason
+	}
+	o.downgrade = reason
+	return nil
+}
+
+// fallbackDisabledError 同时满足 errors.Is(err, ErrFallbackDisabled) 与无法多线程下载的原因。
+type fallbackDisabledError struct {
+	reason error
+}
+
+func (e *fallbackDisabledError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrFallbackDisabled, e.reason)
+}
+
+func (e *fallbackDisabledError) Is(target error) bool {
+	return target == ErrFallbackDisabled
+}
+
+func (e *fallbackDisabledError) Unwrap() error {
+	return e.reason
+}
@@ -0,0 +1,110 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ErrContentMismatch 表示下载的内容与本地内容不一致。
+var ErrContentMismatch = errors.New("content not match")
+
+// ParallelFetch 多线程下载 url，但不写入文件，只将数据交给 fn(参见 WithDataCallback)，
+// 服务器不支持 Range 时按顺序调用 fn。该模式下 WithChecksums 无效。
+func ParallelFetch(download_url string, worker_count int64, fn func(offset int64, data []byte) error, opts ...Option) (*DownloadResult, error) {
+	return ParallelFetchContext(context.Background(), download_url, worker_count, fn, opts...)
+}
+
+// ParallelFetchContext 与 ParallelFetch 相同，ctx 取消时停止下载并返回 ctx.Err()。
+func ParallelFetchContext(ctx context.Context, download_url string, worker_count int64, fn func(offset int64, data []byte) error, opts ...Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	o.onData = fn
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	err := canceledError(ctx, parallelTo(dctx, download_url, writerAtStore{discardWriterAt{}}, worker_count, o))
+	return o.finish(download_url, err), err
+}
+
+// ParallelCompare 多线程下载 url 并与大小为 size 的本地内容 local 比较，不需要把下载内容写到磁盘。
+// 内容或大小不一致时返回 ErrContentMismatch。
+func ParallelCompare(download_url string, local io.ReaderAt, size int64, worker_count int64, opts ...Option) error {
+	return ParallelCompareContext(context.Background(), download_url, local, size, worker_count, opts...)
+}
+
+// ParallelCompareContext 与 ParallelCompare 相同，ctx 取消时停止下载并返回 ctx.Err()。
+func ParallelCompareContext(ctx context.Context, download_url string, local io.ReaderAt, size int64, worker_count int64, opts ...Option) error {
+	var fetched atomic.Int64
+	_, err := ParallelFetchContext(ctx, download_url, worker_count, func(offset int64, data []byte) error {
+		fetched.Add(int64(len(data)))
+		if offset+int64(len(data)) > size {
+			return fmt.Errorf("%w: remote is larger than %d bytes", ErrContentMismatch, size)
+		}
+		want := make([]byte, len(data))
+		if _, err := local.ReadAt(want, offset); err != nil && err != io.EOF {
+			return err
+		}
+		if i := mismatchIndex(want, data); i >= 0 {
+			return fmt.Errorf("%w: at offset %d", ErrContentMismatch, offset+int64(i))
+		}
+		return nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if n := fetched.Load(); n != size {
+		return fmt.Errorf("%w: remote size %d, local size %d", ErrContentMismatch, n, size)
+	}
+	return nil
+}
+
+func mismatchIndex(a, b []byte) int {
+	if bytes.Equal(a, b) {
+		return -1
+	}
+	for i := range a {
+		if i >= len(b) || a[i] != b[i] {
+			return i
+		}
+	}
+	return len(a)
+}
+
+// callbackWriter 将顺序写入的数据连同偏移交给 fn。
+type callbackWriter struct {
+	fn     func(offset int64, data []byte) error
+	offset int64
+}
+
+func (w *callbackWriter) Write(p []byte) (int, error) {
+	if err := w.fn(w.offset, p); err != nil {
+		return 0, err
+	}
+	w.offset += int64(len(p))
+	return len(p), nil
+}
+
+// offsetWriter 从偏移 0 开始把顺序写入转为 WriteAt。
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// discardWriterAt 丢弃所有写入的数据。
+type discardWriterAt struct{}
+
+func (discardWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,80 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallelFetch(t *testing.T) {
+	data := testContent(50000)
+	s := newServer(t, serveData(data))
+	var mu sync.Mutex
+	got := make([]byte, len(data))
+	var total int
+	res, err := ParallelFetch(s.URL+"/f.bin", 4, func(offset int64, p []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		copy(got[offset:], p)
+		total += len(p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != len(data) || !bytes.Equal(got, data) || !res.Parallel || res.Path != "" {
+		t.Fatalf("fetched %d bytes, parallel = %v, path = %q", total, res.Parallel, res.Path)
+	}
+}
+
+func TestParallelCompare(t *testing.T) {
+	data := testContent(50000)
+	s := newServer(t, serveData(data))
+	url := s.URL + "/f.bin"
+
+	if err := ParallelCompare(url, bytes.NewReader(data), int64(len(data)), 4); err != nil {
+		t.Fatalf("identical copy: %v", err)
+	}
+
+	local := append([]byte(nil), data...)
+	local[31234] ^= 0xff
+	err := ParallelCompare(url, bytes.NewReader(local), int64(len(local)), 4)
+	if !errors.Is(err, ErrContentMismatch) || !strings.Contains(err.Error(), "offset 31234") {
+		t.Fatalf("changed byte: err = %v", err)
+	}
+
+	err = ParallelCompare(url, bytes.NewReader(data[:40000]), 40000, 4)
+	if !errors.Is(err, ErrContentMismatch) {
+		t.Fatalf("shorter local copy: err = %v", err)
+	}
+	err = ParallelCompare(url, bytes.NewReader(append(append([]byte(nil), data...), 'x')), int64(len(data))+1, 4)
+	if !errors.Is(err, ErrContentMismatch) {
+		t.Fatalf("longer local copy: err = %v", err)
+	}
+}
+
+func TestParallelFetchContextCancel(t *testing.T) {
+	data := testContent(50000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-0" {
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ParallelFetchContext(ctx, s.URL+"/f.bin", 4, func(int64, []byte) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Fatalf("fetch: err = %v, want ctx.Err()", err)
+	}
+	err = ParallelCompareContext(ctx, s.URL+"/f.bin", bytes.NewReader(data), int64(len(data)), 4)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("compare: err = %v, want ctx.Err()", err)
+	}
+}
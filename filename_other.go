@@ -0,0 +1,8 @@
+//go:build !windows
+
+package paralleldownload
+
+// sanitizeForOS 在 Windows 以外的系统上不做额外处理，/ 与控制字符已由 sanitizeFileName 去掉。
+func sanitizeForOS(name string) string {
+	return name
+}
@@ -0,0 +1,58 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNameFromHeader(t *testing.T) {
+	tests := []struct {
+		disposition string
+		want        string
+	}{
+		{`attachment; filename="report.pdf"`, "report.pdf"},
+		{`attachment; filename=plain.txt; size=3`, "plain.txt"},
+		{`attachment; filename="with;semi.txt"`, "with;semi.txt"},
+		{`attachment; filename*=UTF-8''%E4%B8%AD%E6%96%87.txt`, "中文.txt"},
+		{`attachment; filename="fallback.txt"; filename*=UTF-8''%C3%A9t%C3%A9.txt`, "été.txt"},
+		{`attachment; filename="../../etc/passwd"`, "passwd"},
+		{`attachment; filename=../../etc/passwd`, "passwd"},
+		{`attachment; filename="..\\..\\win.ini"`, "win.ini"},
+		{`attachment; filename=C:\temp\evil.exe`, "evil.exe"},
+		{`attachment; filename=".."`, ""},
+		{`attachment; filename="dir/"`, ""},
+		{`attachment; filename="a` + "\x01" + `b.txt"`, "ab.txt"},
+	}
+	for _, tt := range tests {
+		h := http.Header{"Content-Disposition": {tt.disposition}}
+		if got := sanitizeFileName(getFileNameByHeader(h)); got != tt.want {
+			t.Errorf("%s: name = %q, want %q", tt.disposition, got, tt.want)
+		}
+	}
+}
+
+func TestFileNameTraversal(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../../escaped.bin"`)
+		serveData(data)(w, r)
+	}))
+	root := t.TempDir()
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "escaped.bin"); res.Path != want {
+		t.Fatalf("path = %s, want %s", res.Path, want)
+	}
+	checkFile(t, res.Path, data)
+	if _, err := os.Stat(filepath.Join(root, "escaped.bin")); err == nil {
+		t.Fatal("file written outside the save path")
+	}
+}
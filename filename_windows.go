@@ -0,0 +1,28 @@
+//go:build windows
+
+package paralleldownload
+
+import "strings"
+
+// sanitizeForOS 将 Windows 文件名中不允许的字符替换为 _，去掉结尾的点与空格，
+// 并在 CON、NUL、COM1 等保留名前加上 _。
+func sanitizeForOS(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	base := strings.ToUpper(name)
+	if i := strings.Index(base, "."); i >= 0 {
+		base = base[:i]
+	}
+	switch base {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		return "_" + name
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package paralleldownload
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// FS 为保存下载文件的文件系统，参见 WithFS。路径为所在系统的格式(与 filepath 一致)，
+// 错误应满足 errors.Is(err, fs.ErrNotExist) 等判断。
+type FS interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	MkdirAll(path string, perm os.FileMode) error
+}
+
+// File 为 FS 打开的文件，各分片并发调用 WriteAt，*os.File 满足该接口。
+type File interface {
+	io.Reader
+	io.Writer
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// chtimesFS 为支持修改时间的 FS，DownloadIfNewer 用其设置下载文件的修改时间。
+type chtimesFS interface {
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// osFS 为默认的本地文件系统。
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		// 避免返回包含 nil *os.File 的非 nil 接口
+		return nil, err
+	}
+	return f, nil
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+// fsys 返回保存文件使用的 FS，未设置 WithFS 时为本地文件系统。
+func (o *options) fsys() FS {
+	if o.fs != nil {
+		return o.fs
+	}
+	return osFS{}
+}
+
+// preallocateFile 为 f 预先分配 size 字节，f 不是 *os.File 时改为 Truncate。
+func preallocateFile(f File, size int64) error {
+	if osf, ok := f.(*os.File); ok {
+		return preallocate(osf, size)
+	}
+	return f.Truncate(size)
+}
+
+// writeFileAtomic 先写入 path.tmp 再重命名为 path，崩溃时不会留下不完整的文件。
+func writeFileAtomic(fsys FS, path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := fsys.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return fsys.Rename(tmp, path)
+}
+
+// readFile 读取 fsys 中的整个文件。
+func readFile(fsys FS, path string) ([]byte, error) {
+	f, err := fsys.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,287 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memFS 为测试用的内存文件系统，目录只记录路径。
+type memFS struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	dirs  map[string]bool
+}
+
+type memData struct {
+	data    []byte
+	modTime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: make(map[string]*memData), dirs: make(map[string]bool)}
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[name]
+	switch {
+	case ok && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok && !m.dirs[filepath.Dir(name)]:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		d = &memData{modTime: time.Now()}
+		m.files[name] = d
+	}
+	if flag&os.O_TRUNC != 0 {
+		d.data = nil
+	}
+	f := &memFile{fs: m, name: name, d: d}
+	if flag&os.O_APPEND != 0 {
+		f.pos = int64(len(d.data))
+	}
+	return f, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d, ok := m.files[name]; ok {
+		return memInfo{name: filepath.Base(name), size: int64(len(d.data)), modTime: d.modTime}, nil
+	}
+	if m.dirs[name] {
+		return memInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = d
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := path; !m.dirs[p]; p = filepath.Dir(p) {
+		m.dirs[p] = true
+	}
+	return nil
+}
+
+// read 返回 name 的内容。
+func (m *memFS) read(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.files[name]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), d.data...), true
+}
+
+type memFile struct {
+	fs   *memFS
+	name string
+	d    *memData
+	pos  int64
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	n, err := f.WriteAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(f.d.data)) {
+		f.d.data = append(f.d.data, make([]byte, end-int64(len(f.d.data)))...)
+	}
+	f.d.modTime = time.Now()
+	return copy(f.d.data[off:], p), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if size <= int64(len(f.d.data)) {
+		f.d.data = f.d.data[:size]
+	} else {
+		f.d.data = append(f.d.data, make([]byte, size-int64(len(f.d.data)))...)
+	}
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) { return f.fs.Stat(f.name) }
+func (f *memFile) Sync() error                { return nil }
+func (f *memFile) Close() error               { return nil }
+
+type memInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() any           { return nil }
+
+func (i memInfo) Mode() os.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func TestWithFS(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	dir := t.TempDir()
+	saveDir := filepath.Join(dir, "sub")
+	mfs := newMemFS()
+	mfs.MkdirAll(saveDir, 0755)
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", saveDir, "", 4, WithFS(mfs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Path != filepath.Join(saveDir, "f.bin") {
+		t.Fatalf("path = %s", res.Path)
+	}
+	if got, ok := mfs.read(res.Path); !ok || string(got) != string(data) {
+		t.Fatalf("memory file: found %v, %d bytes", ok, len(got))
+	}
+	if _, err := mfs.Stat(res.Path + ".download"); err == nil {
+		t.Fatal("temporary file left in fsys")
+	}
+	if len(mfs.files) != 1 {
+		t.Fatalf("temporary files left: %d files", len(mfs.files))
+	}
+	// 本地文件系统不受影响
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("local dir has %d entries, err %v", len(entries), err)
+	}
+}
+
+func TestWithFSResume(t *testing.T) {
+	data := testContent(40000)
+	const partStart, partEnd, half = 30000, 39999, 5000
+	partRange := fmt.Sprintf("bytes=%d-%d", partStart, partEnd)
+	var hang atomic.Bool
+	hang.Store(true)
+	var mu sync.Mutex
+	var ranges []string
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rng)
+		mu.Unlock()
+		if rng == partRange && hang.Load() {
+			// 最后一个分片发送一半后卡住，直到下载被取消
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", partStart, partEnd, len(data)))
+			w.Header().Set("Content-Length", fmt.Sprint(partEnd-partStart+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[partStart : partStart+half])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	dir := t.TempDir()
+	mfs := newMemFS()
+	mfs.MkdirAll(dir, 0755)
+	h := StartParallelDownload(s.URL+"/f.bin", dir, "", 4, WithFS(mfs), WithResume(), WithBufferSize(1000))
+	waitFor(t, "half of the last part", func() bool {
+		return h.Progress().Downloaded == int64(len(data))-half
+	})
+	h.Cancel()
+	if _, err := h.Wait(); err == nil {
+		t.Fatal("canceled download succeeded")
+	}
+
+	hang.Store(false)
+	mu.Lock()
+	ranges = nil
+	mu.Unlock()
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, WithFS(mfs), WithResume())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resumed {
+		t.Fatal("download did not resume from the progress in fsys")
+	}
+	if got, _ := mfs.read(res.Path); string(got) != string(data) {
+		t.Fatal("content mismatch after resume")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := fmt.Sprintf("bytes=%d-%d", partStart+half, partEnd)
+	resumed := false
+	for _, rng := range ranges {
+		if rng != want && rng != "bytes=0-0" && rng != "" {
+			t.Fatalf("resumed download requested %q, want only %q", rng, want)
+		}
+		resumed = resumed || rng == want
+	}
+	if !resumed {
+		t.Fatalf("rest of the last part not requested (all: %q)", ranges)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("local dir has %d entries, err %v", len(entries), err)
+	}
+}
@@ -0,0 +1,249 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ftpProtocol 通过 FTP 被动模式下载，用 REST 从任意位置开始读取。
+// 每次 Stat 与 Open 使用单独的控制连接，URL 不含用户名时匿名登录。
+type ftpProtocol struct{}
+
+func (ftpProtocol) Stat(ctx context.Context, u *url.URL) (int64, bool, error) {
+	c, err := dialFTP(ctx, u)
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.quit()
+	defer c.closeOnDone(ctx)()
+	size := c.size(u.Path)
+	// 服务器接受 REST 即支持从任意位置开始读取
+	_, _, err = c.cmd(3, "REST 0")
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, false, ctxErr
+	}
+	return size, err == nil, nil
+}
+
+func (ftpProtocol) Open(ctx context.Context, u *url.URL, offset int64) (io.ReadCloser, int64, error) {
+	c, err := dialFTP(ctx, u)
+	if err != nil {
+		return nil, 0, err
+	}
+	stop := c.closeOnDone(ctx)
+	defer stop()
+	size := c.size(u.Path)
+	data, err := c.passive(ctx)
+	if err != nil {
+		c.quit()
+		return nil, 0, err
+	}
+	if offset > 0 {
+		if _, _, err := c.cmd(3, "REST %d", offset); err != nil {
+			data.Close()
+			c.quit()
+			return nil, 0, fmt.Errorf("%w: %v", ErrRangeNotSupported, err)
+		}
+	}
+	if _, _, err := c.cmd(1, "RETR %s", u.Path); err != nil {
+		data.Close()
+		c.quit()
+		return nil, 0, err
+	}
+	stop()
+	return c.body(ctx, data), size, nil
+}
+
+// ftpConn 为一个已登录的 FTP 控制连接。
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+func dialFTP(ctx context.Context, u *url.URL) (*ftpConn, error) {
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, fmt.Errorf("ftp url %s does not name a file", u.Redacted())
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn)}
+	// 登录期间 ctx 结束时关闭连接，中断阻塞的读写
+	stop := c.closeOnDone(ctx)
+	defer stop()
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		c.text.Close()
+		return nil, fmt.Errorf("ftp connect %s: %w", addr, err)
+	}
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		_, _, err = c.cmd(2, "PASS %s", pass)
+	} else if err == nil && code/100 != 2 {
+		err = &textproto.Error{Code: code, Msg: msg}
+	}
+	if err == nil {
+		_, _, err = c.cmd(2, "TYPE I")
+	}
+	if err != nil || ctx.Err() != nil {
+		c.text.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("ftp login %s: %w", addr, err)
+	}
+	return c, nil
+}
+
+// cmd 发送一条命令并读取响应，expect 为期望的响应码前缀(如 2 表示 2xx)，0 表示不检查。
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.text.ReadResponse(expect)
+}
+
+// size 返回 path 的大小，服务器不支持 SIZE 时返回 -1。
+func (c *ftpConn) size(path string) int64 {
+	_, msg, err := c.cmd(2, "SIZE %s", path)
+	if err != nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil || size < 0 {
+		return -1
+	}
+	return size
+}
+
+// passive 以 EPSV(不支持时 PASV)打开数据连接。
+func (c *ftpConn) passive(ctx context.Context) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	var addr string
+	if _, msg, err := c.cmd(2, "EPSV"); err == nil {
+		// 229 Entering Extended Passive Mode (|||port|)
+		i, j := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if i < 0 || j < i+4 {
+			return nil, fmt.Errorf("ftp: invalid EPSV response %q", msg)
+		}
+		addr = net.JoinHostPort(host, msg[i+4:j])
+	} else {
+		_, msg, err := c.cmd(2, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		i, j := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if i < 0 || j < i {
+			return nil, fmt.Errorf("ftp: invalid PASV response %q", msg)
+		}
+		fields := strings.Split(msg[i+1:j], ",")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("ftp: invalid PASV response %q", msg)
+		}
+		p1, err1 := strconv.Atoi(fields[4])
+		p2, err2 := strconv.Atoi(fields[5])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("ftp: invalid PASV response %q", msg)
+		}
+		addr = net.JoinHostPort(strings.Join(fields[:4], "."), strconv.Itoa(p1<<8|p2))
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// closeOnDone 在 ctx 结束时关闭控制连接，返回的函数停止等待。
+func (c *ftpConn) closeOnDone(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.Close()
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (c *ftpConn) quit() {
+	c.cmd(0, "QUIT")
+	c.text.Close()
+}
+
+// body 返回读取数据连接的 io.ReadCloser，ctx 结束时中断读取，关闭时结束传输并退出登录。
+func (c *ftpConn) body(ctx context.Context, data net.Conn) io.ReadCloser {
+	b := &ftpBody{c: c, data: data, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			data.Close()
+			c.conn.Close()
+		case <-b.done:
+		}
+	}()
+	return b
+}
+
+// ftpBody 为 RETR 的数据连接。
+type ftpBody struct {
+	c    *ftpConn
+	data net.Conn
+	done chan struct{}
+	once sync.Once
+	eof  error // 数据读完后传输的结果
+}
+
+func (b *ftpBody) Read(p []byte) (int, error) {
+	if b.eof != nil {
+		return 0, b.eof
+	}
+	n, err := b.data.Read(p)
+	if err == io.EOF {
+		// 数据连接关闭后检查传输是否完整
+		b.eof = io.EOF
+		if _, _, rerr := b.c.text.ReadResponse(2); rerr != nil {
+			var te *textproto.Error
+			if errors.As(rerr, &te) {
+				b.eof = fmt.Errorf("ftp transfer failed: %w", rerr)
+			} else {
+				b.eof = io.ErrUnexpectedEOF
+			}
+		}
+		return n, b.eof
+	}
+	return n, err
+}
+
+func (b *ftpBody) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+		b.data.Close()
+		// 未读完时服务器回复 426 或 226，均忽略
+		b.c.quit()
+	})
+	return nil
+}
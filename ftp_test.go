@@ -0,0 +1,195 @@
+package paralleldownload
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ftpServer 为测试用的 FTP 服务器，只支持下载 path 一个文件。
+type ftpServer struct {
+	path  string
+	data  []byte
+	rest  bool // 是否接受 REST
+	epsv  bool // 是否支持 EPSV，不支持时只能用 PASV
+	addr  string
+	mu    sync.Mutex
+	users []string
+	rests []int64 // RETR 时生效的 REST 偏移
+}
+
+func newFTPServer(t *testing.T, path string, data []byte, rest bool, epsv bool) *ftpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &ftpServer{path: path, data: data, rest: rest, epsv: epsv, addr: l.Addr().String()}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *ftpServer) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(c, format+"\r\n", args...)
+	}
+	reply("220 test server ready")
+	var data net.Listener
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+	listen := func() bool {
+		if data != nil {
+			data.Close()
+		}
+		var err error
+		data, err = net.Listen("tcp", "127.0.0.1:0")
+		return err == nil
+	}
+	var offset int64
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			s.mu.Lock()
+			s.users = append(s.users, arg)
+			s.mu.Unlock()
+			reply("331 password required")
+		case "PASS":
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 type set")
+		case "SIZE":
+			if arg != s.path {
+				reply("550 no such file")
+				continue
+			}
+			reply("213 %d", len(s.data))
+		case "EPSV":
+			if !s.epsv || !listen() {
+				reply("502 not implemented")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "PASV":
+			if !listen() {
+				reply("425 cannot open data connection")
+				continue
+			}
+			port := data.Addr().(*net.TCPAddr).Port
+			reply("227 Entering Passive Mode (127,0,0,1,%d,%d)", port>>8, port&0xff)
+		case "REST":
+			n, err := strconv.ParseInt(arg, 10, 64)
+			if !s.rest || err != nil || n < 0 || n > int64(len(s.data)) {
+				reply("502 REST not supported")
+				continue
+			}
+			offset = n
+			reply("350 restarting at %d", n)
+		case "RETR":
+			if arg != s.path || data == nil {
+				reply("550 no such file")
+				continue
+			}
+			reply("150 opening data connection")
+			dc, err := data.Accept()
+			if err != nil {
+				reply("425 cannot open data connection")
+				continue
+			}
+			s.mu.Lock()
+			s.rests = append(s.rests, offset)
+			s.mu.Unlock()
+			// 客户端读够分片后提前关闭数据连接，写入失败时忽略
+			_, err = dc.Write(s.data[offset:])
+			dc.Close()
+			data.Close()
+			data, offset = nil, 0
+			if err != nil {
+				reply("426 transfer aborted")
+			} else {
+				reply("226 transfer complete")
+			}
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestFTPParallel(t *testing.T) {
+	data := testContent(1 << 20)
+	s := newFTPServer(t, "/pub/f.bin", data, true, true)
+	res, err := ParallelDownloadEx("ftp://alice:secret@"+s.addr+"/pub/f.bin", t.TempDir(), "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if !res.Parallel {
+		t.Fatalf("not parallel: %v", res.FallbackReason)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u != "alice" {
+			t.Fatalf("logged in as %q", u)
+		}
+	}
+	// 每个分片从自己的起点 REST
+	starts := map[int64]bool{}
+	for _, off := range s.rests {
+		starts[off] = true
+	}
+	for i := int64(0); i < 4; i++ {
+		if !starts[i*int64(len(data))/4] {
+			t.Fatalf("no RETR from offset %d, got %v", i*int64(len(data))/4, s.rests)
+		}
+	}
+}
+
+func TestFTPWithoutRest(t *testing.T) {
+	data := testContent(100000)
+	// 只支持 PASV，不接受 REST 的服务器
+	s := newFTPServer(t, "/f.bin", data, false, false)
+	res, err := ParallelDownloadEx("ftp://"+s.addr+"/f.bin", t.TempDir(), "", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if res.Parallel {
+		t.Fatal("parallel download from a server without REST")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.users) == 0 || s.users[0] != "anonymous" {
+		t.Fatalf("users = %v, want anonymous", s.users)
+	}
+	for _, off := range s.rests {
+		if off != 0 {
+			t.Fatalf("RETR from offset %d", off)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package paralleldownload
+
+// Get 多线程下载 url，下载位置、线程数等均通过 Option 设置(WithSavePath、WithFilename、WithWorkers、
+// WithHTTPClient、WithContext 等)，服务器不支持 Range 时回退到单线程下载。
+// ParallelDownload、Download 等函数保持不变。
+func Get(download_url string, opts ...Option) (*DownloadResult, error) {
+	return (&Downloader{}).Get(download_url, opts...)
+}
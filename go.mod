@@ -2,4 +2,16 @@ module github.com/Doraemonkeys/ParallelDownload
 
 go 1.19
 
-require golang.org/x/sync v0.0.0-20220929204114-8fcdb60fdcc0
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.17.4
+	github.com/pkg/sftp v1.13.6
+	golang.org/x/crypto v0.17.0
+	golang.org/x/sync v0.0.0-20220929204114-8fcdb60fdcc0
+	golang.org/x/time v0.5.0
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
@@ -0,0 +1,188 @@
+package paralleldownload
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Handle 为在后台运行的下载任务。
+type Handle struct {
+	done   chan struct{}
+	result *DownloadResult
+	err    error
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	running  map[int64]context.CancelFunc
+	requeued map[int64]bool
+	progress *progressReporter
+	paused   bool
+	resumed  chan struct{} // Resume 时关闭
+}
+
+// StartParallelDownload 在后台开始 ParallelDownload，返回的 Handle 可用于控制与等待下载。
+func StartParallelDownload(download_url string, savePath string, filename string, worker_count int64, opts ...Option) *Handle {
+	h := newHandle(context.Background())
+	go h.run(download_url, savePath, filename, worker_count, opts)
+	return h
+}
+
+func newHandle(ctx context.Context) *Handle {
+	h := &Handle{
+		done:     make(chan struct{}),
+		running:  make(map[int64]context.CancelFunc),
+		requeued: make(map[int64]bool),
+	}
+	h.ctx, h.cancel = context.WithCancel(ctx)
+	return h
+}
+
+// run 执行下载，结束后保存结果并唤醒 Wait。
+func (h *Handle) run(download_url string, savePath string, filename string, worker_count int64, opts []Option) {
+	defer close(h.done)
+	defer h.cancel()
+	o := newOptions(opts)
+	if o.err != nil {
+		h.err = o.err
+		return
+	}
+	o.handle = h
+	proceed := o.shouldProceed
+	o.shouldProceed = func() bool {
+		// 单线程下载无法按分片重新请求，暂停时保持连接并停止读取
+		return !h.Paused() && (proceed == nil || proceed())
+	}
+	defer o.audit.close()
+	ctx, cancel := o.context(h.ctx)
+	defer cancel()
+	h.err = canceledError(h.ctx, parallelDownload(ctx, download_url, savePath, filename, worker_count, o))
+	h.result = o.finish(download_url, h.err)
+}
+
+// Wait 等待下载结束并返回结果。
+func (h *Handle) Wait() (*DownloadResult, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// Cancel 停止下载，Wait 返回 context.Canceled，不完整的文件按 WithKeepPartial、WithResume 处理。
+func (h *Handle) Cancel() {
+	h.cancel()
+}
+
+// Pause 暂停下载：取消各分片当前的请求，已写入的数据保留，Resume 后各分片从已写入的位置继续请求。
+// 单线程下载时保持连接并停止读取。暂停期间 WithTimeout 仍在计时。
+func (h *Handle) Pause() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.paused {
+		return
+	}
+	h.paused = true
+	h.resumed = make(chan struct{})
+	for num, cancel := range h.running {
+		h.requeued[num] = true
+		cancel()
+	}
+}
+
+// Resume 继续被 Pause 暂停的下载。
+func (h *Handle) Resume() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.paused {
+		return
+	}
+	h.paused = false
+	close(h.resumed)
+}
+
+// Paused 报告下载是否处于暂停状态。
+func (h *Handle) Paused() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.paused
+}
+
+// waitResumed 在暂停时阻塞直到 Resume 或 ctx 结束。
+func (h *Handle) waitResumed(ctx context.Context) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	paused, resumed := h.paused, h.resumed
+	h.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done 返回下载结束时关闭的 channel。
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Progress 返回下载的当前进度，可供界面定时轮询。Speed 为最近约 1 秒的平均速度，
+// 下载结束后 Done 为 true。开始下载之前 Total、Percent 与 ETA 为 -1。
+func (h *Handle) Progress() ProgressRecord {
+	h.mu.Lock()
+	r := h.progress
+	h.mu.Unlock()
+	if r == nil {
+		return ProgressRecord{Time: time.Now(), Total: -1, Percent: -1, ETA: -1}
+	}
+	return r.snapshot()
+}
+
+// setProgress 设置当前使用的进度，回退到单线程下载时会被替换。
+func (h *Handle) setProgress(r *progressReporter) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.progress = r
+	h.mu.Unlock()
+}
+
+// CancelPart 取消编号为 num 的分片当前的请求，并重新请求它尚未下载的部分，
+// 已写入的数据不会重复下载。可用于处理个别过慢的连接。
+func (h *Handle) CancelPart(num int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cancel, ok := h.running[num]
+	if !ok {
+		return fmt.Errorf("part %d is not running", num)
+	}
+	h.requeued[num] = true
+	cancel()
+	return nil
+}
+
+// track 为分片创建可单独取消的 context，返回的函数结束跟踪并报告该分片是否被 CancelPart 取消。
+func (h *Handle) track(ctx context.Context, num int64) (context.Context, func() bool) {
+	if h == nil {
+		return ctx, func() bool { return false }
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	h.mu.Lock()
+	h.running[num] = cancel
+	h.mu.Unlock()
+	return ctx, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		cancel()
+		delete(h.running, num)
+		requeued := h.requeued[num]
+		delete(h.requeued, num)
+		return requeued
+	}
+}
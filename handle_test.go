@@ -0,0 +1,146 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询 cond 直到为 true，超时则测试失败。
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCancelPart(t *testing.T) {
+	data := testContent(30000)
+	const partStart, partEnd, half = 10000, 19999, 5000
+	partRange := fmt.Sprintf("bytes=%d-%d", partStart, partEnd)
+	var mu sync.Mutex
+	var ranges []string
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rng)
+		mu.Unlock()
+		if rng == partRange {
+			// 分片 1 发送一半后卡住，直到被取消
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", partStart, partEnd, len(data)))
+			w.Header().Set("Content-Length", fmt.Sprint(partEnd-partStart+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[partStart : partStart+half])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+
+	dir := t.TempDir()
+	// 缓冲区填满才写入，取能整除分片已发送部分的大小，进度才会停在一半
+	h := StartParallelDownload(s.URL+"/f.bin", dir, "", 3, WithBufferSize(1000))
+	waitFor(t, "half of part 1", func() bool {
+		p := h.Progress()
+		return p.Downloaded == int64(len(data))-half
+	})
+	if err := h.CancelPart(1); err != nil {
+		t.Fatal(err)
+	}
+	res, err := h.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "f.bin"), data)
+	if res.Size != int64(len(data)) {
+		t.Fatalf("size = %d, want %d", res.Size, len(data))
+	}
+	// 重新请求时只请求分片 1 剩余的部分
+	want := fmt.Sprintf("bytes=%d-%d", partStart+half, partEnd)
+	mu.Lock()
+	defer mu.Unlock()
+	if last := ranges[len(ranges)-1]; last != want {
+		t.Fatalf("requeued range = %q, want %q (all: %q)", last, want, ranges)
+	}
+
+	if err := h.CancelPart(1); err == nil {
+		t.Fatal("CancelPart succeeded after the download finished")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	data := testContent(40000)
+	const partStart, partEnd, half = 30000, 39999, 5000
+	partRange := fmt.Sprintf("bytes=%d-%d", partStart, partEnd)
+	var mu sync.Mutex
+	var ranges []string
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rng)
+		mu.Unlock()
+		if rng == partRange {
+			// 最后一个分片发送一半后卡住，直到请求被取消
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", partStart, partEnd, len(data)))
+			w.Header().Set("Content-Length", fmt.Sprint(partEnd-partStart+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[partStart : partStart+half])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	requests := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ranges...)
+	}
+
+	dir := t.TempDir()
+	h := StartParallelDownload(s.URL+"/f.bin", dir, "", 4, WithBufferSize(1000))
+	t.Cleanup(h.Cancel)
+	waitFor(t, "half of the last part", func() bool {
+		return h.Progress().Downloaded == int64(len(data))-half
+	})
+	h.Pause()
+	if !h.Paused() {
+		t.Fatal("Paused() = false after Pause")
+	}
+	before := len(requests())
+	time.Sleep(300 * time.Millisecond)
+	if n := h.Progress().Downloaded; n != int64(len(data))-half {
+		t.Fatalf("downloaded %d bytes while paused, want %d", n, len(data)-half)
+	}
+	if after := requests(); len(after) != before {
+		t.Fatalf("requests sent while paused: %q", after[before:])
+	}
+
+	h.Resume()
+	if _, err := h.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "f.bin"), data)
+	// 继续时只请求未完成分片剩余的部分，已完成的分片不重新请求
+	want := fmt.Sprintf("bytes=%d-%d", partStart+half, partEnd)
+	parts := map[string]int{}
+	for _, rng := range requests() {
+		parts[rng]++
+	}
+	if parts[want] != 1 {
+		t.Fatalf("resumed range %q requested %d times (all: %q)", want, parts[want], requests())
+	}
+	for rng, n := range parts {
+		if n > 1 {
+			t.Fatalf("range %q requested %d times", rng, n)
+		}
+	}
+}
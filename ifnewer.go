@@ -0,0 +1,82 @@
+package paralleldownload
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DownloadIfNewer 仅在远程文件比 localPath 新时多线程下载并覆盖 localPath，
+// 本地文件已是最新时不下载，返回结果的 UpToDate 为 true。
+// 判断依据为带 If-Modified-Since 的 HEAD 请求：返回 304，或 Last-Modified 不晚于本地修改时间且大小一致时视为最新。
+// 服务器不提供 Last-Modified 时总是下载。下载完成后本地文件的修改时间设为远程的 Last-Modified。
+func DownloadIfNewer(ctx context.Context, download_url string, localPath string, opts ...Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	ctx, cancel := o.context(ctx)
+	defer cancel()
+	modified, upToDate := remoteNewer(ctx, download_url, localPath, o)
+	if upToDate {
+		o.logger.Info("local file is up to date", "path", localPath)
+		res := o.finish(download_url, nil)
+		res.UpToDate = true
+		return res, nil
+	}
+	err := parallelDownload(ctx, download_url, filepath.Dir(localPath), filepath.Base(localPath), 0, o)
+	if !o.modified.IsZero() {
+		// 以实际下载的响应为准，本地文件不存在时 remoteNewer 不会请求服务器
+		modified = o.modified
+	}
+	if err == nil && !modified.IsZero() {
+		if fsys, ok := o.fsys().(chtimesFS); ok {
+			if err := fsys.Chtimes(localPath, time.Now(), modified); err != nil {
+				o.logger.Warn("set modification time failed", "path", localPath, "error", err)
+			}
+		}
+	}
+	return o.finish(download_url, err), err
+}
+
+// remoteNewer 比较远程文件与 localPath，返回远程的 Last-Modified(未知时为零值)及本地是否已是最新。
+// 请求失败时视为需要下载，由之后的下载报告错误。
+func remoteNewer(ctx context.Context, download_url string, localPath string, o *options) (modified time.Time, upToDate bool) {
+	local, err := o.fsys().Stat(localPath)
+	if err != nil || !local.Mode().IsRegular() {
+		return time.Time{}, false
+	}
+	req, err := o.newRequest(ctx, "HEAD", download_url)
+	if err != nil {
+		return time.Time{}, false
+	}
+	req.Header.Set("If-Modified-Since", local.ModTime().UTC().Format(http.TimeFormat))
+	resp, err := o.do(o.client, req)
+	if err != nil {
+		return time.Time{}, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return time.Time{}, true
+	}
+	if resp.StatusCode >= 300 {
+		return time.Time{}, false
+	}
+	modified, err = http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	// HTTP 日期只精确到秒
+	if modified.After(local.ModTime().Truncate(time.Second)) {
+		return modified, false
+	}
+	if length := o.contentLength(resp.Header); length != "" {
+		if size, err := strconv.ParseInt(length, 10, 64); err == nil && size != local.Size() {
+			return modified, false
+		}
+	}
+	return modified, true
+}
@@ -0,0 +1,91 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// versionedServer 提供修改时间可变的文件，gets 统计 GET 请求数。
+type versionedServer struct {
+	mu       sync.Mutex
+	data     []byte
+	modified time.Time
+	gets     atomic.Int32
+}
+
+func (v *versionedServer) set(data []byte, modified time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data, v.modified = data, modified
+}
+
+func (v *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	data, modified := v.data, v.modified
+	v.mu.Unlock()
+	if r.Method == http.MethodGet {
+		v.gets.Add(1)
+	}
+	http.ServeContent(w, r, "", modified, bytes.NewReader(data))
+}
+
+func TestDownloadIfNewer(t *testing.T) {
+	v1 := testContent(10000)
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	srv := &versionedServer{}
+	srv.set(v1, modified)
+	s := newServer(t, srv)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "f.bin")
+
+	// 本地没有文件
+	res, err := DownloadIfNewer(ctx, s.URL+"/f.bin", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UpToDate {
+		t.Fatal("missing file reported up to date")
+	}
+	checkFile(t, path, v1)
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(modified) {
+		t.Fatalf("modification time not set to Last-Modified: %v", err)
+	}
+
+	// 本地已是最新
+	srv.gets.Store(0)
+	res, err = DownloadIfNewer(ctx, s.URL+"/f.bin", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.UpToDate || srv.gets.Load() != 0 {
+		t.Fatalf("up to date = %v, %d GET requests", res.UpToDate, srv.gets.Load())
+	}
+
+	// 远程更新
+	v2 := testContent(12000)
+	srv.set(v2, modified.Add(time.Hour))
+	res, err = DownloadIfNewer(ctx, s.URL+"/f.bin", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.UpToDate {
+		t.Fatal("stale file reported up to date")
+	}
+	checkFile(t, path, v2)
+
+	// 本地文件比远程旧
+	if err := os.Chtimes(path, time.Now(), modified); err != nil {
+		t.Fatal(err)
+	}
+	res, err = DownloadIfNewer(ctx, s.URL+"/f.bin", path)
+	if err != nil || res.UpToDate {
+		t.Fatalf("older local file: up to date = %v, err = %v", res.UpToDate, err)
+	}
+}
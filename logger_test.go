@@ -0,0 +1,91 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// logEntry 为 recordLogger 记录的一条日志。
+type logEntry struct {
+	level string
+	msg   string
+	attrs map[string]any
+}
+
+// recordLogger 记录所有日志，供测试检查。
+type recordLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) log(level, msg string, args []any) {
+	attrs := make(map[string]any)
+	for i := 0; i+1 < len(args); i += 2 {
+		if key, ok := args[i].(string); ok {
+			attrs[key] = args[i+1]
+		}
+	}
+	l.mu.Lock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, attrs: attrs})
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) Debug(msg string, args ...any) { l.log("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...any)  { l.log("info", msg, args) }
+func (l *recordLogger) Warn(msg string, args ...any)  { l.log("warn", msg, args) }
+func (l *recordLogger) Error(msg string, args ...any) { l.log("error", msg, args) }
+
+// find 返回第一条消息为 msg 的日志。
+func (l *recordLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestDownloadPlanLog(t *testing.T) {
+	data := testContent(4000)
+	s := newServer(t, serveData(data))
+	logger := &recordLogger{}
+	if err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 4, WithLogger(logger), WithBufferSize(8<<10)); err != nil {
+		t.Fatal(err)
+	}
+	plan, ok := logger.find("download plan")
+	if !ok {
+		t.Fatal("no download plan logged")
+	}
+	if plan.level != "debug" {
+		t.Fatalf("plan logged at %s, want debug", plan.level)
+	}
+	want := map[string]any{
+		"size":          int64(4000),
+		"range_support": true,
+		"workers":       int64(4),
+		"parts":         []string{"0-999", "1000-1999", "2000-2999", "3000-3999"},
+		"buffer_size":   8 << 10,
+	}
+	for key, v := range want {
+		if !reflect.DeepEqual(plan.attrs[key], v) {
+			t.Errorf("plan %s = %#v, want %#v", key, plan.attrs[key], v)
+		}
+	}
+
+	// 不支持 Range 时同样记录原因
+	logger = &recordLogger{}
+	noRange := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	if err := ParallelDownload(noRange.URL+"/f.bin", t.TempDir(), "", 4, WithLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+	plan, ok = logger.find("download plan")
+	if !ok || plan.attrs["range_support"] != false || plan.attrs["reason"] == nil {
+		t.Fatalf("fallback plan = %+v", plan)
+	}
+}
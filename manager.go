@@ -0,0 +1,203 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ItemStatus 为 Manager 中一个下载任务的状态。
+type ItemStatus int
+
+const (
+	// ItemQueued 表示等待空位开始下载。
+	ItemQueued ItemStatus = iota
+	// ItemRunning 表示正在下载。
+	ItemRunning
+	// ItemDone 表示下载成功。
+	ItemDone
+	// ItemFailed 表示下载失败。
+	ItemFailed
+	// ItemCanceled 表示被 Item.Cancel 或 Manager.Cancel 取消。
+	ItemCanceled
+)
+
+func (s ItemStatus) String() string {
+	switch s {
+	case ItemQueued:
+		return "queued"
+	case ItemRunning:
+		return "running"
+	case ItemDone:
+		return "done"
+	case ItemFailed:
+		return "failed"
+	case ItemCanceled:
+		return "canceled"
+	}
+	return fmt.Sprintf("ItemStatus(%d)", int(s))
+}
+
+// Manager 管理一批下载任务，最多同时下载 concurrency 个文件，其余的排队等待。
+type Manager struct {
+	opts       []Option
+	onComplete func(*Item)
+	slots      chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu        sync.Mutex
+	items     []*Item
+	wg        sync.WaitGroup
+	statePath string      // Load 的文件，为空时不保存
+	history   []stateItem // Load 读取到的已结束的任务
+	saveMu    sync.Mutex
+	logger    Logger
+}
+
+// Item 为 Manager 中的一个下载任务。
+type Item struct {
+	URL      string
+	h        *Handle
+	done     chan struct{}
+	savePath string
+	filename string
+	workers  int64
+
+	mu       sync.Mutex
+	status   ItemStatus
+	canceled bool // 是否被 Item.Cancel 取消
+}
+
+// NewManager 返回最多同时下载 concurrency 个文件的 Manager，concurrency <= 0 时不限制。
+// 每个任务结束后(包括失败与取消)调用 onComplete，可为 nil。opts 应用于所有任务，Add 传入的 Option 在其后应用。
+func NewManager(concurrency int, onComplete func(*Item), opts ...Option) *Manager {
+	m := &Manager{opts: append([]Option(nil), opts...), onComplete: onComplete}
+	if concurrency > 0 {
+		m.slots = make(chan struct{}, concurrency)
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	return m
+}
+
+// Add 将多线程下载 download_url 加入队列，参数与 ParallelDownload 相同。
+func (m *Manager) Add(download_url string, savePath string, filename string, worker_count int64, opts ...Option) *Item {
+	item := &Item{URL: download_url, h: newHandle(m.ctx), done: make(chan struct{}),
+		savePath: savePath, filename: filename, workers: worker_count}
+	opts = append(m.opts[:len(m.opts):len(m.opts)], opts...)
+	m.mu.Lock()
+	if m.statePath != "" {
+		// 进程重启后从 .pdpart 记录的进度继续
+		opts = append(opts, WithResume())
+	}
+	m.items = append(m.items, item)
+	m.mu.Unlock()
+	m.save()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		if m.acquire(item.h.ctx) {
+			item.setStatus(ItemRunning)
+			m.save()
+			item.h.run(download_url, savePath, filename, worker_count, opts)
+			m.release()
+		} else {
+			item.h.err = item.h.ctx.Err()
+			item.h.cancel()
+			close(item.h.done)
+		}
+		switch err := item.h.err; {
+		case err == nil:
+			item.setStatus(ItemDone)
+		case errors.Is(err, context.Canceled) && item.h.ctx.Err() != nil:
+			item.setStatus(ItemCanceled)
+		default:
+			item.setStatus(ItemFailed)
+		}
+		m.save()
+		close(item.done)
+		if m.onComplete != nil {
+			m.onComplete(item)
+		}
+	}()
+	return item
+}
+
+// acquire 等待空位，ctx 结束时返回 false。
+func (m *Manager) acquire(ctx context.Context) bool {
+	if m.slots == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case m.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (m *Manager) release() {
+	if m.slots != nil {
+		<-m.slots
+	}
+}
+
+// Items 返回已加入的所有任务，按加入的顺序排列。
+func (m *Manager) Items() []*Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Item(nil), m.items...)
+}
+
+// Wait 等待已加入的所有任务结束。
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Cancel 取消所有尚未结束的任务，之后加入的任务也会被立即取消。
+func (m *Manager) Cancel() {
+	m.cancel()
+}
+
+// Status 返回任务的当前状态。
+func (it *Item) Status() ItemStatus {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.status
+}
+
+func (it *Item) setStatus(s ItemStatus) {
+	it.mu.Lock()
+	it.status = s
+	it.mu.Unlock()
+}
+
+// Progress 返回任务的当前进度，参见 Handle.Progress。
+func (it *Item) Progress() ProgressRecord {
+	return it.h.Progress()
+}
+
+// Pause 暂停任务，参见 Handle.Pause。
+func (it *Item) Pause() {
+	it.h.Pause()
+}
+
+// Resume 继续被暂停的任务。
+func (it *Item) Resume() {
+	it.h.Resume()
+}
+
+// Cancel 取消任务，排队中的任务不再开始。
+func (it *Item) Cancel() {
+	it.mu.Lock()
+	it.canceled = true
+	it.mu.Unlock()
+	it.h.Cancel()
+}
+
+// Wait 等待任务结束并返回结果。
+func (it *Item) Wait() (*DownloadResult, error) {
+	<-it.done
+	return it.h.result, it.h.err
+}
@@ -0,0 +1,102 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerConcurrency(t *testing.T) {
+	data := testContent(10000)
+	var mu sync.Mutex
+	active := map[string]int{}
+	maxFiles := 0
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active[r.URL.Path]++
+		if len(active) > maxFiles {
+			maxFiles = len(active)
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		serveData(data)(w, r)
+		mu.Lock()
+		if active[r.URL.Path]--; active[r.URL.Path] == 0 {
+			delete(active, r.URL.Path)
+		}
+		mu.Unlock()
+	}))
+
+	var completed []*Item
+	var cmu sync.Mutex
+	m := NewManager(2, func(it *Item) {
+		cmu.Lock()
+		completed = append(completed, it)
+		cmu.Unlock()
+	})
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		m.Add(s.URL+"/"+name, dir, "", 2)
+	}
+	m.Wait()
+	if maxFiles > 2 {
+		t.Fatalf("%d files downloaded at once, limit is 2", maxFiles)
+	}
+	if len(completed) != 5 {
+		t.Fatalf("onComplete called %d times", len(completed))
+	}
+	for _, it := range m.Items() {
+		res, err := it.Wait()
+		if err != nil || it.Status() != ItemDone {
+			t.Fatalf("%s: status %v, err %v", it.URL, it.Status(), err)
+		}
+		checkFile(t, res.Path, data)
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	dir := t.TempDir()
+	m := NewManager(1, nil)
+	t.Cleanup(m.Cancel)
+	running := m.Add(s.URL+"/a", dir, "", 2)
+	queued := m.Add(s.URL+"/b", dir, "", 2)
+	waitFor(t, "an item running", func() bool {
+		return running.Status() == ItemRunning || queued.Status() == ItemRunning
+	})
+	if queued.Status() == ItemRunning {
+		running, queued = queued, running
+	}
+	if queued.Status() != ItemQueued {
+		t.Fatalf("second item status %v with concurrency 1", queued.Status())
+	}
+
+	// 取消排队中的任务不影响其他任务
+	queued.Cancel()
+	if _, err := queued.Wait(); err == nil || queued.Status() != ItemCanceled {
+		t.Fatalf("queued item: status %v, err %v", queued.Status(), err)
+	}
+	if running.Status() != ItemRunning {
+		t.Fatalf("running item status %v after canceling another item", running.Status())
+	}
+
+	running.Cancel()
+	if _, err := running.Wait(); err == nil || running.Status() != ItemCanceled {
+		t.Fatalf("running item: status %v, err %v", running.Status(), err)
+	}
+
+	// Manager.Cancel 取消所有任务，之后加入的任务也立即取消
+	other := m.Add(s.URL+"/other", dir, "", 2)
+	waitFor(t, "item running", func() bool { return other.Status() == ItemRunning })
+	m.Cancel()
+	late := m.Add(s.URL+"/late", dir, "", 2)
+	m.Wait()
+	for _, it := range []*Item{other, late} {
+		if it.Status() != ItemCanceled {
+			t.Fatalf("%s: status %v after Manager.Cancel", it.URL, it.Status())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package paralleldownload
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxMetalinkSize 为读取 Metalink 文件的上限。
+const maxMetalinkSize = 16 << 20
+
+// Metalink 为 Metalink 文件(RFC 5854 的 .meta4 或 3.0 版的 .metalink)描述的文件列表。
+type Metalink struct {
+	Files []MetalinkFile
+}
+
+// MetalinkFile 为 Metalink 中的一个文件。
+type MetalinkFile struct {
+	// Name 为保存的相对路径，可以包含目录
+	Name string
+	// Size 为文件大小，未知时为 -1
+	Size int64
+	// Hashes 为整个文件的摘要，键为算法名(如 sha256)，只包含支持的算法
+	Hashes map[string]string
+	// PieceAlgo、PieceSize 与 Pieces 为分块摘要，参见 WithPieceChecksums，没有时 Pieces 为空
+	PieceAlgo string
+	PieceSize int64
+	Pieces    []string
+	// URLs 为下载地址，按优先级从高到低排列
+	URLs []string
+}
+
+// metalinkXML 同时匹配 Metalink 4(file 直接位于根元素下)与 3.0(位于 files 下)的结构。
+type metalinkXML struct {
+	Files  []metalinkFileXML `xml:"file"`
+	Files3 []metalinkFileXML `xml:"files>file"`
+}
+
+type metalinkFileXML struct {
+	Name      string             `xml:"name,attr"`
+	Size      *int64             `xml:"size"`
+	Hashes    []metalinkHashXML  `xml:"hash"`
+	Hashes3   []metalinkHashXML  `xml:"verification>hash"`
+	Pieces    *metalinkPiecesXML `xml:"pieces"`
+	Pieces3   *metalinkPiecesXML `xml:"verification>pieces"`
+	URLs      []metalinkURLXML   `xml:"url"`
+	Resources []metalinkURLXML   `xml:"resources>url"`
+}
+
+type metalinkHashXML struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type metalinkPiecesXML struct {
+	Type   string            `xml:"type,attr"`
+	Length int64             `xml:"length,attr"`
+	Hashes []metalinkHashXML `xml:"hash"`
+}
+
+type metalinkURLXML struct {
+	// Priority 为 Metalink 4 的优先级，1 最高；Preference 为 3.0 的偏好，100 最高
+	Priority   int    `xml:"priority,attr"`
+	Preference int    `xml:"preference,attr"`
+	Type       string `xml:"type,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// ParseMetalink 解析 Metalink 4(RFC 5854)或 3.0 格式的文件。
+// 不支持的摘要算法被忽略，BitTorrent 等非下载地址不包含在 URLs 中。
+func ParseMetalink(r io.Reader) (*Metalink, error) {
+	var doc metalinkXML
+	if err := xml.NewDecoder(io.LimitReader(r, maxMetalinkSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse metalink: %w", err)
+	}
+	ml := &Metalink{}
+	for _, fx := range append(doc.Files, doc.Files3...) {
+		f, err := fx.file()
+		if err != nil {
+			return nil, err
+		}
+		ml.Files = append(ml.Files, f)
+	}
+	if len(ml.Files) == 0 {
+		return nil, fmt.Errorf("parse metalink: no file")
+	}
+	return ml, nil
+}
+
+func (fx metalinkFileXML) file() (MetalinkFile, error) {
+	f := MetalinkFile{Name: strings.TrimSpace(fx.Name), Size: -1}
+	clean := path.Clean(f.Name)
+	// 文件名来自远程，不能跳出保存目录，最后一级也必须是文件名而不是 "."、".." 或以 / 结尾的目录
+	base := f.Name[strings.LastIndex(f.Name, "/")+1:]
+	if base == "" || base == "." || base == ".." || clean == "." || path.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, "../") || strings.Contains(f.Name, `\`) {
+		return f, fmt.Errorf("parse metalink: invalid file name %q", fx.Name)
+	}
+	f.Name = clean
+	if fx.Size != nil {
+		f.Size = *fx.Size
+	}
+	for _, h := range append(fx.Hashes, fx.Hashes3...) {
+		if algo, ok := metalinkAlgo(h.Type); ok && strings.TrimSpace(h.Value) != "" {
+			if f.Hashes == nil {
+				f.Hashes = make(map[string]string)
+			}
+			f.Hashes[algo] = strings.TrimSpace(h.Value)
+		}
+	}
+	pieces := fx.Pieces
+	if pieces == nil {
+		pieces = fx.Pieces3
+	}
+	if pieces != nil && pieces.Length > 0 {
+		if algo, ok := metalinkAlgo(pieces.Type); ok {
+			f.PieceAlgo, f.PieceSize = algo, pieces.Length
+			for _, h := range pieces.Hashes {
+				f.Pieces = append(f.Pieces, strings.TrimSpace(h.Value))
+			}
+		}
+	}
+	type ranked struct {
+		url  string
+		rank int
+	}
+	var urls []ranked
+	for _, u := range fx.URLs {
+		rank := u.Priority
+		if rank <= 0 {
+			rank = 999999
+		}
+		urls = append(urls, ranked{strings.TrimSpace(u.Value), rank})
+	}
+	for _, u := range fx.Resources {
+		if u.Type == "bittorrent" {
+			continue
+		}
+		urls = append(urls, ranked{strings.TrimSpace(u.Value), 1000000 - u.Preference})
+	}
+	sort.SliceStable(urls, func(i, j int) bool { return urls[i].rank < urls[j].rank })
+	for _, u := range urls {
+		if u.url != "" {
+			f.URLs = append(f.URLs, u.url)
+		}
+	}
+	if len(f.URLs) == 0 {
+		return f, fmt.Errorf("parse metalink: no url for %s", f.Name)
+	}
+	return f, nil
+}
+
+// metalinkAlgo 将 Metalink 使用的 IANA 摘要算法名(如 sha-256)转换为 WithChecksums 的算法名。
+func metalinkAlgo(name string) (string, bool) {
+	algo := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "-", "")
+	_, ok := hashFuncs[algo]
+	return algo, ok
+}
+
+// Options 返回按 f 下载所需的 Option：其余地址作为镜像，校验文件大小、摘要与分块摘要。
+func (f MetalinkFile) Options() []Option {
+	opts := []Option{withExpectedSize(f.Size)}
+	if len(f.URLs) > 1 {
+		opts = append(opts, WithMirrors(f.URLs[1:]...))
+	}
+	if len(f.Hashes) > 0 {
+		opts = append(opts, WithChecksums(f.Hashes))
+	}
+	if len(f.Pieces) > 0 {
+		opts = append(opts, WithPieceChecksums(f.PieceAlgo, f.PieceSize, f.Pieces))
+	}
+	return opts
+}
+
+// DownloadMetalink 按 Metalink 文件下载其中的所有文件到 savePath，参见 Downloader.DownloadMetalink。
+func DownloadMetalink(ctx context.Context, metalink string, savePath string, worker_count int64, opts ...Option) ([]*DownloadResult, error) {
+	return (&Downloader{}).DownloadMetalink(ctx, metalink, savePath, worker_count, opts...)
+}
+
+// DownloadMetalink 按 Metalink 文件依次下载其中的所有文件到 savePath，metalink 为本地路径或 URL
+// (以 Downloader 的配置获取)。每个文件从所有地址多线程下载(参见 WithMirrors)，
+// 并校验大小、摘要与分块摘要。遇到第一个失败的文件即停止，返回已下载文件的结果。
+func (d *Downloader) DownloadMetalink(ctx context.Context, metalink string, savePath string, worker_count int64, opts ...Option) ([]*DownloadResult, error) {
+	ml, err := d.loadMetalink(ctx, metalink)
+	if err != nil {
+		return nil, err
+	}
+	o := d.options(opts)
+	o.audit.close()
+	var results []*DownloadResult
+	for _, f := range ml.Files {
+		dir := filepath.Join(savePath, filepath.FromSlash(path.Dir(f.Name)))
+		if err := o.fsys().MkdirAll(dir, 0755); err != nil {
+			return results, err
+		}
+		fopts := append(opts[:len(opts):len(opts)], f.Options()...)
+		res, err := d.ParallelDownloadContext(ctx, f.URLs[0], dir, path.Base(f.Name), worker_count, fopts...)
+		if err != nil {
+			return results, fmt.Errorf("download %s: %w", f.Name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func (d *Downloader) loadMetalink(ctx context.Context, metalink string) (*Metalink, error) {
+	if u, err := url.Parse(metalink); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		// 单个字母的 scheme 为 Windows 盘符
+		r := ParallelDownloadReader(ctx, metalink, 1, d.opts...)
+		defer r.Close()
+		return ParseMetalink(r)
+	}
+	f, err := os.Open(metalink)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMetalink(f)
+}
@@ -0,0 +1,46 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseMetalinkFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // 为空表示应当拒绝
+	}{
+		{"data.bin", "data.bin"},
+		{"sub/data.bin", "sub/data.bin"},
+		{"sub/./x/../data.bin", "sub/data.bin"},
+		{"", ""},
+		{"  ", ""},
+		{".", ""},
+		{"..", ""},
+		{"dir/.", ""},
+		{"dir/..", ""},
+		{"dir/", ""},
+		{"../escape.bin", ""},
+		{"sub/../../escape.bin", ""},
+		{"/etc/passwd", ""},
+		{`sub\data.bin`, ""},
+	}
+	for _, tt := range tests {
+		doc := fmt.Sprintf(`<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name=%q><url>http://example.com/f</url></file></metalink>`, tt.name)
+		ml, err := ParseMetalink(strings.NewReader(doc))
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("name %q accepted as %q", tt.name, ml.Files[0].Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("name %q: %v", tt.name, err)
+			continue
+		}
+		if got := ml.Files[0].Name; got != tt.want {
+			t.Errorf("name %q parsed as %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
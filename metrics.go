@@ -0,0 +1,109 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"time"
+)
+
+// Metrics 接收下载过程中的指标，用于对接 Prometheus、expvar 等。多个下载可共用同一个 Metrics，
+// 各方法均为增量，可并发调用。
+type Metrics interface {
+	// AddBytes 累加写入的字节数，每秒及下载结束时调用
+	AddBytes(n int64)
+	// AddRetries 累加分片重试、刷新链接、更换镜像等导致的重试次数
+	AddRetries(n int64)
+	// AddPartFailures 累加重试后仍失败的分片数
+	AddPartFailures(n int64)
+	// AddActiveWorkers 在一个分片(或单线程下载)开始时加 1，结束时减 1
+	AddActiveWorkers(delta int64)
+	// AddSpeed 累加当前速度(字节/秒)的变化量，下载结束时减去其速度，共用时为所有下载的总速度
+	AddSpeed(delta float64)
+}
+
+// meter 每秒根据 downloadStats 向 Metrics 汇报字节数、重试次数与速度。
+type meter struct {
+	m    Metrics
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startMetrics 开始汇报指标，未设置 WithMetrics 时不做任何事。
+func (o *options) startMetrics() {
+	if o.metrics == nil {
+		return
+	}
+	mt := &meter{m: o.metrics, stop: make(chan struct{}), done: make(chan struct{})}
+	o.meter = mt
+	go func() {
+		defer close(mt.done)
+		ticker := time.NewTicker(speedSampleInterval)
+		defer ticker.Stop()
+		var bytes, retries int64
+		var speed float64
+		flush := func() int64 {
+			cur := o.stats.written.Load()
+			d := cur - bytes
+			if d > 0 {
+				mt.m.AddBytes(d)
+			}
+			bytes = cur
+			if r := o.stats.retries.Load(); r > retries {
+				mt.m.AddRetries(r - retries)
+				retries = r
+			}
+			return d
+		}
+		for {
+			select {
+			case <-ticker.C:
+				cur := float64(flush()) / speedSampleInterval.Seconds()
+				mt.m.AddSpeed(cur - speed)
+				speed = cur
+			case <-mt.stop:
+				flush()
+				if speed != 0 {
+					mt.m.AddSpeed(-speed)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// close 停止汇报并提交剩余的字节数与重试次数。
+func (mt *meter) close() {
+	if mt == nil {
+		return
+	}
+	close(mt.stop)
+	<-mt.done
+}
+
+func (mt *meter) addActive(delta int64) {
+	if mt != nil {
+		mt.m.AddActiveWorkers(delta)
+	}
+}
+
+func (mt *meter) partFailed() {
+	if mt != nil {
+		mt.m.AddPartFailures(1)
+	}
+}
+
+// statsWriter 在单线程下载时随写入累加 downloadStats.written，使速度与进度及时更新；
+// max > 0 时写入超过 max 字节返回 ErrTooLarge(参见 WithMaxSize)。
+type statsWriter struct {
+	s   *downloadStats
+	max int64
+	n   int64
+}
+
+func (w *statsWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	if w.max > 0 && w.n > w.max {
+		return 0, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, w.max)
+	}
+	w.s.written.Add(int64(len(p)))
+	return len(p), nil
+}
@@ -0,0 +1,106 @@
+package paralleldownload
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingMetrics 累加 Metrics 收到的指标。
+type countingMetrics struct {
+	bytes, retries, failures atomic.Int64
+
+	mu                sync.Mutex
+	active, maxActive int64
+	speed             float64
+}
+
+func (m *countingMetrics) AddBytes(n int64)        { m.bytes.Add(n) }
+func (m *countingMetrics) AddRetries(n int64)      { m.retries.Add(n) }
+func (m *countingMetrics) AddPartFailures(n int64) { m.failures.Add(n) }
+
+func (m *countingMetrics) AddActiveWorkers(delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active += delta
+	if m.active > m.maxActive {
+		m.maxActive = m.active
+	}
+}
+
+func (m *countingMetrics) AddSpeed(delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.speed += delta
+}
+
+// idle 断言没有活动的线程且总速度已归零。
+func (m *countingMetrics) idle(t *testing.T) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active != 0 || math.Abs(m.speed) > 1e-6 {
+		t.Fatalf("after download: %d active workers, speed %v", m.active, m.speed)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	m := &countingMetrics{}
+	// 两个下载共用同一个 Metrics
+	for i := 0; i < 2; i++ {
+		if _, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithMetrics(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := m.bytes.Load(); n != 2*int64(len(data)) {
+		t.Fatalf("bytes = %d, want %d", n, 2*len(data))
+	}
+	if m.retries.Load() != 0 || m.failures.Load() != 0 {
+		t.Fatalf("retries = %d, failures = %d", m.retries.Load(), m.failures.Load())
+	}
+	if m.maxActive < 1 || m.maxActive > 4 {
+		t.Fatalf("max active workers = %d", m.maxActive)
+	}
+	m.idle(t)
+}
+
+func TestMetricsRetriesAndFailures(t *testing.T) {
+	data := testContent(40000)
+	var failed atomic.Bool
+	flaky := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 最后一个分片第一次请求返回 500
+		if r.Header.Get("Range") == "bytes=30000-39999" && failed.CompareAndSwap(false, true) {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	m := &countingMetrics{}
+	if _, err := ParallelDownloadEx(flaky.URL+"/f.bin", t.TempDir(), "", 4, WithMetrics(m), WithRetry(2, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if m.retries.Load() != 1 || m.failures.Load() != 0 || m.bytes.Load() != int64(len(data)) {
+		t.Fatalf("retries = %d, failures = %d, bytes = %d", m.retries.Load(), m.failures.Load(), m.bytes.Load())
+	}
+	m.idle(t)
+
+	broken := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=30000-39999" {
+			http.NotFound(w, r)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	m = &countingMetrics{}
+	if _, err := ParallelDownloadEx(broken.URL+"/f.bin", t.TempDir(), "", 4, WithMetrics(m)); err == nil {
+		t.Fatal("download with a missing part succeeded")
+	}
+	if m.failures.Load() < 1 {
+		t.Fatal("part failure not reported")
+	}
+	m.idle(t)
+}
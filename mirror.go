@@ -0,0 +1,125 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// ParallelDownloadMirrors 从多个镜像多线程下载同一个文件，urls[0] 为主地址，参见 WithMirrors。
+func ParallelDownloadMirrors(ctx context.Context, urls []string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return (&Downloader{}).ParallelDownloadMirrors(ctx, urls, savePath, filename, worker_count, opts...)
+}
+
+// probe 获取文件信息。设置了 WithMirrors 时主地址不可用则依次尝试各镜像，
+// 返回第一个可用的地址，其余地址留在 o.mirrors 中供分片使用。全部不可用时返回主地址的结果。
+func (o *options) probe(ctx context.Context, download_url string) (url string, size int64, header http.Header, resolved string, err error) {
+	size, header, resolved, err = getInfoAndCheckRangeSupport(ctx, download_url, o)
+	if err == nil && len(o.mirrors) == 0 {
+		o.validator = rangeValidator(header)
+	}
+	if err == nil || len(o.mirrors) == 0 || ctx.Err() != nil {
+		return download_url, size, header, resolved, err
+	}
+	o.logger.Warn("mirror unavailable", "url", download_url, "err", err)
+	for i, u := range o.mirrors {
+		s, h, r, merr := getInfoAndCheckRangeSupport(ctx, u, o)
+		if merr == nil {
+			o.mirrors = append(append([]string{download_url}, o.mirrors[:i]...), o.mirrors[i+1:]...)
+			return u, s, h, r, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		o.logger.Warn("mirror unavailable", "url", u, "err", merr)
+	}
+	// 全部不可用时按主地址的结果处理，如单线程下载
+	return download_url, size, header, resolved, err
+}
+
+// mirrorSet 为分片分配镜像。出错或卡住的镜像被降级，其分片剩余的部分改从其他镜像下载，
+// 最后一个可用的镜像不再降级。
+type mirrorSet struct {
+	mu       sync.Mutex
+	urls     []string
+	demoted  map[string]bool
+	assigned map[int64]string
+}
+
+// newMirrorSet 在设置了 WithMirrors 时返回 mirrorSet，download_url 为探测成功的地址。
+func (o *options) newMirrorSet(download_url string) *mirrorSet {
+	if len(o.mirrors) == 0 {
+		return nil
+	}
+	return &mirrorSet{
+		urls:     append([]string{download_url}, o.mirrors...),
+		demoted:  make(map[string]bool),
+		assigned: make(map[int64]string),
+	}
+}
+
+// pick 返回分片 part_num 使用的镜像，未分配或已降级时在可用的镜像中轮流分配。
+func (m *mirrorSet) pick(part_num int64) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if url, ok := m.assigned[part_num]; ok && !m.demoted[url] {
+		return url
+	}
+	var healthy []string
+	for _, url := range m.urls {
+		if !m.demoted[url] {
+			healthy = append(healthy, url)
+		}
+	}
+	url := m.urls[0]
+	if len(healthy) > 0 {
+		i := part_num % int64(len(healthy))
+		if i < 0 {
+			i = 0
+		}
+		url = healthy[i]
+	}
+	m.assigned[part_num] = url
+	return url
+}
+
+// failover 在 err 由镜像引起且还有其他可用镜像时降级分片 part_num 使用的镜像，返回被降级的镜像。
+func (m *mirrorSet) failover(part_num int64, err error) (string, bool) {
+	if m == nil || !mirrorFault(err) {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, ok := m.assigned[part_num]
+	if !ok {
+		return "", false
+	}
+	for _, url := range m.urls {
+		if url != from && !m.demoted[url] {
+			m.demoted[from] = true
+			delete(m.assigned, part_num)
+			return from, true
+		}
+	}
+	return "", false
+}
+
+// mirrorFault 判断分片的错误是否由镜像引起，写入、回调等本地错误不换镜像。
+// 证书错误与被拒绝的重定向不会重试，但换一个镜像可能成功。
+func mirrorFault(err error) bool {
+	var se *StatusError
+	var re *retryAfterError
+	return errors.Is(err, ErrPartStalled) || errors.Is(err, ErrUnstableContent) ||
+		errors.Is(err, ErrRangeNotSupported) || errors.Is(err, ErrURLExpired) || errors.Is(err, ErrETagMismatch) ||
+		errors.Is(err, ErrCrossHostRedirect) || errors.Is(err, ErrTooManyRedirects) || isTLSError(err) ||
+		errors.As(err, &se) || errors.As(err, &re) || isTransient(err)
+}
+
+// urlFor 返回分片 part_num 请求的地址。
+func (w *worker) urlFor(part_num int64) string {
+	if w.mirrors != nil {
+		return w.mirrors.pick(part_num)
+	}
+	return w.currentURL()
+}
@@ -0,0 +1,50 @@
+package paralleldownload
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMirrorFailover(t *testing.T) {
+	data := testContent(40000)
+	tests := []struct {
+		name string
+		bad  http.HandlerFunc
+	}{
+		{"5xx", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}},
+		// 文件大小与主地址不一致
+		{"wrong size", serveData(data[:len(data)-100])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var badGets atomic.Int32
+			bad := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					badGets.Add(1)
+				}
+				tt.bad(w, r)
+			}))
+			good := newServer(t, serveData(data))
+			logger := &recordLogger{}
+			// 10 个分块由 2 个线程下载，不降级时约一半分配给坏镜像
+			res, err := ParallelDownloadMirrors(context.Background(), []string{good.URL + "/f.bin", bad.URL + "/f.bin"},
+				t.TempDir(), "", 2, WithChunkSize(4000), WithLogger(logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, res.Path, data)
+			e, ok := logger.find("mirror demoted")
+			if !ok || e.attrs["mirror"] != bad.URL+"/f.bin" {
+				t.Fatalf("bad mirror not demoted: %+v", e)
+			}
+			// 降级前最多有 2 个分块同时请求坏镜像，之后不再请求
+			if n := badGets.Load(); n == 0 || n > 2 {
+				t.Fatalf("bad mirror got %d part requests, want 1 or 2", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,1151 @@
+package paralleldownload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrETagMismatch 表示服务器上的文件版本与 WithExpectETag 指定的 ETag 不一致。
+var ErrETagMismatch = errors.New("etag not match")
+
+// ErrCrossHostRedirect 表示在 WithSameHostRedirectsOnly 下遇到了跨主机的重定向。
+var ErrCrossHostRedirect = errors.New("cross-host redirect refused")
+
+// ErrTooManyRedirects 表示重定向次数超过了 WithMaxRedirects 的限制。
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// ErrTooLarge 表示文件超过了 WithMaxSize 的限制。
+var ErrTooLarge = errors.New("file too large")
+
+// defaultMaxRedirects 为未设置 WithMaxRedirects 时最多跟随的重定向次数，与 net/http 相同。
+const defaultMaxRedirects = 10
+
+const defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.55 Safari/537.36"
+
+// defaultWorkers 为 worker_count <= 0 且未设置环境变量时的最大线程数。
+const defaultWorkers = 4
+
+// Option 用于配置下载行为，可传给 Download 与 ParallelDownload。
+type Option func(*options)
+
+type options struct {
+	ignoreServerFilename bool
+	expectedMagic        []byte
+	sameHostRedirects    bool
+	maxRedirects         int // -1 表示未设置
+	fallbackPolicy       FallbackPolicy
+	expectETag           string
+	sizeHeader           string
+	logger               Logger
+	urlProvider          func(ctx context.Context) (string, error)
+	urlExpired           func(resp *http.Response) bool
+	mirrors              []string
+	stallTimeout         time.Duration
+	minSpeed             int64
+	minSpeedWindow       time.Duration
+	checksums            map[string]string
+	auditWriter          io.Writer
+	assumeRangeSupport   bool
+	userAgent            string
+	headers              http.Header
+	cookieJar            http.CookieJar
+	cookies              []*http.Cookie
+	requestHook          func(*http.Request) error
+	responseHook         func(*http.Response) error
+	rateLimit            int64
+	partRateLimit        int64
+	workers              int64 // worker_count <= 0 时使用的线程数
+	concurrency          int   // 同时下载的分片数上限，0 表示不限制
+	chunkSize            int64 // 分块大小，0 表示按 worker_count 等分
+	stealMinSize         int64 // 拆分较慢分片时每部分的最小字节数，0 表示不拆分
+	onData               func(offset int64, data []byte) error
+	shouldProceed        func() bool
+	compression          bool
+	keepEncoded          bool
+	timeout              time.Duration
+	resume               bool
+	keepPartial          bool
+	keepCorrupt          bool
+	symlinkPolicy        SymlinkPolicy
+	fs                   FS
+	existPolicy          ExistPolicy
+	tees                 []io.Writer
+	teeBuffer            int64
+	bufferSize           int
+	pieceAlgo            string
+	pieceSize            int64
+	pieceSums            []string
+	connAffinity         ConnAffinity
+	progressFunc         ProgressFunc
+	progressWriter       io.Writer
+	progressRecordFunc   func(ProgressRecord)
+	progressInterval     time.Duration
+	maxRetryAfter        time.Duration
+	retryAfterFail       bool
+	destFunc             func(info FileInfo) (dir, name string, err error)
+	shrinkPolicy         ShrinkPolicy
+	reportFunc           func(Report)
+	metrics              Metrics
+	protocols            map[string]Protocol
+	events               chan<- Event
+	expectedSize         int64 // Metalink 中的文件大小，-1 表示不检查
+	maxSize              int64 // 允许的最大文件大小，0 表示不限制
+	manifestAlgo         string
+	manifest             map[string]string
+	httpClient           *http.Client
+	proxy                *url.URL
+	tlsConfig            *tls.Config
+	rootCAs              *x509.CertPool
+	clientCerts          []tls.Certificate
+	insecureSkipVerify   bool
+	maxConnsPerHost      int
+	maxIdlePerHost       int
+	idleTimeout          time.Duration
+	retryAttempts        int
+	savePath             string
+	filename             string
+	ctx                  context.Context
+	retryBackoff         time.Duration
+
+	// err 记录无效的配置，下载开始前返回
+	err error
+
+	// client 由以上配置生成，所有请求共用
+	client     *http.Client
+	clone      *http.Transport // buildClient 复制的 Transport，下载结束时关闭其空闲连接
+	stats      downloadStats
+	audit      *auditLog
+	handle     *Handle
+	limiter    *rate.Limiter
+	checkpoint *checkpoint
+	received   *receivedRanges
+	buffers    *sync.Pool // 分片读取响应体的缓冲区
+	tee        *orderedTee
+	dest       string    // destFunc 选择的保存路径
+	modified   time.Time // 下载的文件响应中的 Last-Modified，未知时为零值
+	report     *reportCollector
+	meter      *meter
+	emitter    *eventStream
+	started    time.Time
+	savedPath  string      // 保存文件的路径
+	finalURL   string      // 跟随重定向后实际下载的地址
+	downgrade  error       // 回退到单线程下载的原因
+	parallel   bool        // 是否使用多线程下载
+	skipped    bool        // 是否因文件已存在跳过了下载
+	upToDate   bool        // 是否因本地文件已是最新跳过了下载
+	version    http.Header // ExistUpdate 下载完成后记录的远程文件版本
+	validator  string      // 获取文件信息时得到的 ETag 或 Last-Modified，分片请求以 If-Range 带上
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		logger:        nopLogger{},
+		urlExpired:    isURLExpired,
+		userAgent:     defaultUserAgent,
+		workers:       defaultWorkers,
+		maxRetryAfter: defaultMaxRetryAfter,
+		teeBuffer:     maxTeeBuffer,
+		bufferSize:    defaultBufferSize,
+		stallTimeout:  defaultStallTimeout,
+		expectedSize:  -1,
+		maxRedirects:  -1,
+	}
+	invalidEnv := applyEnv(o)
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	for _, v := range invalidEnv {
+		o.logger.Warn("ignore invalid environment variable", "env", v)
+	}
+	o.client = o.buildClient()
+	o.received = &receivedRanges{}
+	o.buffers = newBufferPool(o.bufferSize)
+	o.tee = newOrderedTee(o.tees, o.teeBuffer)
+	if o.auditWriter != nil {
+		o.audit = newAuditLog(o.auditWriter)
+	}
+	if o.rateLimit > 0 {
+		o.limiter = newRateLimiter(o.rateLimit)
+	}
+	return o
+}
+
+func (o *options) buildClient() *http.Client {
+	client := &http.Client{}
+	if o.httpClient != nil {
+		// 复制一份，避免修改调用者的 client
+		*client = *o.httpClient
+	}
+	if o.sameHostRedirects || o.maxRedirects >= 0 {
+		client.CheckRedirect = o.checkRedirect(client.CheckRedirect)
+	}
+	if o.cookieJar != nil {
+		client.Jar = o.cookieJar
+	}
+	customTLS := o.tlsConfig != nil || o.rootCAs != nil || len(o.clientCerts) > 0 || o.insecureSkipVerify
+	customPool := o.maxConnsPerHost > 0 || o.maxIdlePerHost > 0 || o.idleTimeout > 0
+	if o.proxy == nil && !customTLS && !customPool {
+		return client
+	}
+	transport, err := o.transport(client)
+	if err != nil {
+		o.err = err
+		return client
+	}
+	if o.proxy != nil {
+		transport.Proxy = http.ProxyURL(o.proxy)
+	}
+	if customTLS {
+		cfg := transport.TLSClientConfig.Clone()
+		if o.tlsConfig != nil {
+			cfg = o.tlsConfig.Clone()
+		}
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if o.rootCAs != nil {
+			cfg.RootCAs = o.rootCAs
+		}
+		cfg.Certificates = append(cfg.Certificates, o.clientCerts...)
+		if o.insecureSkipVerify {
+			cfg.InsecureSkipVerify = true
+		}
+		transport.TLSClientConfig = cfg
+	}
+	if o.maxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = o.maxConnsPerHost
+	}
+	if o.maxIdlePerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.maxIdlePerHost
+		if transport.MaxIdleConns > 0 && transport.MaxIdleConns < o.maxIdlePerHost {
+			transport.MaxIdleConns = o.maxIdlePerHost
+		}
+	}
+	if o.idleTimeout > 0 {
+		transport.IdleConnTimeout = o.idleTimeout
+	}
+	client.Transport = transport
+	o.clone = transport
+	return client
+}
+
+// transport 返回 client 的 Transport 的副本，用于修改代理、TLS 等设置而不影响调用者的 client。
+func (o *options) transport(client *http.Client) (*http.Transport, error) {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("cannot configure transport of type %T", base)
+	}
+	return transport.Clone(), nil
+}
+
+// context 返回下载使用的 context，设置了 WithTimeout 时带有超时。
+func (o *options) context(parent context.Context) (context.Context, context.CancelFunc) {
+	o.started = time.Now()
+	o.startReport()
+	o.startMetrics()
+	o.startEvents()
+	if o.timeout > 0 {
+		return context.WithTimeout(parent, o.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// logArgs 以键值对形式返回生效的配置，用于输出日志。
+func (o *options) logArgs() []any {
+	return []any{
+		"ignore_server_filename", o.ignoreServerFilename,
+		"expected_magic", string(o.expectedMagic),
+		"same_host_redirects", o.sameHostRedirects,
+		"max_redirects", o.maxRedirects,
+		"fallback_policy", o.fallbackPolicy.String(),
+		"expect_etag", o.expectETag,
+		"size_header", o.sizeHeader,
+		"url_provider", o.urlProvider != nil,
+		"mirrors", len(o.mirrors),
+		"stall_timeout", o.stallTimeout,
+		"min_speed", o.minSpeed,
+		"min_speed_window", o.minSpeedWindow,
+		"checksums", len(o.checksums),
+		"audit_log", o.auditWriter != nil,
+		"assume_range_support", o.assumeRangeSupport,
+		"user_agent", o.userAgent,
+		"headers", len(o.headers),
+		"cookie_jar", o.cookieJar != nil,
+		"cookies", len(o.cookies),
+		"request_hook", o.requestHook != nil,
+		"response_hook", o.responseHook != nil,
+		"rate_limit", o.rateLimit,
+		"part_rate_limit", o.partRateLimit,
+		"data_callback", o.onData != nil,
+		"should_proceed", o.shouldProceed != nil,
+		"compression", o.compression,
+		"keep_encoded", o.keepEncoded,
+		"timeout", o.timeout,
+		"resume", o.resume,
+		"keep_partial", o.keepPartial,
+		"keep_corrupt", o.keepCorrupt,
+		"symlink_policy", o.symlinkPolicy.String(),
+		"fs", o.fs != nil,
+		"exist_policy", o.existPolicy.String(),
+		"tees", len(o.tees),
+		"tee_buffer", o.teeBuffer,
+		"buffer_size", o.bufferSize,
+		"piece_checksums", len(o.pieceSums),
+		"piece_size", o.pieceSize,
+		"conn_affinity", o.connAffinity.String(),
+		"progress_func", o.progressFunc != nil,
+		"progress_json", o.progressWriter != nil,
+		"progress_records", o.progressRecordFunc != nil,
+		"progress_interval", o.progressInterval,
+		"max_retry_after", o.maxRetryAfter,
+		"retry_after_fail", o.retryAfterFail,
+		"destination_func", o.destFunc != nil,
+		"shrink_policy", o.shrinkPolicy.String(),
+		"completion_report", o.reportFunc != nil,
+		"metrics", o.metrics != nil,
+		"protocols", len(o.protocols),
+		"events", o.events != nil,
+		"expected_size", o.expectedSize,
+		"max_size", o.maxSize,
+		"checksum_manifest", len(o.manifest),
+		"http_client", o.httpClient != nil,
+		"proxy", o.proxy.Redacted(),
+		"tls_config", o.tlsConfig != nil,
+		"root_cas", o.rootCAs != nil,
+		"client_certs", len(o.clientCerts),
+		"insecure_skip_verify", o.insecureSkipVerify,
+		"max_conns_per_host", o.maxConnsPerHost,
+		"max_idle_per_host", o.maxIdlePerHost,
+		"idle_timeout", o.idleTimeout,
+		"retry_attempts", o.retryAttempts,
+		"retry_backoff", o.retryBackoff,
+		"concurrency", o.concurrency,
+		"chunk_size", o.chunkSize,
+		"work_stealing", o.stealMinSize,
+		"save_path", o.savePath,
+		"filename", o.filename,
+	}
+}
+
+// newRequest 创建请求并附加配置中的请求头。
+func (o *options) newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	ctx = httptrace.WithClientTrace(ctx, o.stats.clientTrace())
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if o.userAgent != "" {
+		req.Header.Set("User-Agent", o.userAgent)
+	}
+	for k, v := range o.headers {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	for _, c := range o.cookies {
+		req.AddCookie(c)
+	}
+	if o.expectETag != "" {
+		req.Header.Set("If-Match", o.expectETag)
+	}
+	return req, nil
+}
+
+// do 发送 req，发送前调用 WithRequestHook，收到响应后调用 WithResponseHook。
+func (o *options) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if o.requestHook != nil {
+		if err := o.requestHook(req); err != nil {
+			return nil, fmt.Errorf("request hook error: %w", err)
+		}
+	}
+	var resp *http.Response
+	var err error
+	if p := o.protocolFor(req.URL.Scheme); p != nil {
+		resp, err = roundTrip(p, req)
+	} else {
+		resp, err = client.Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if o.responseHook != nil {
+		if err := o.responseHook(resp); err != nil {
+			closeBody(resp)
+			return nil, fmt.Errorf("response hook error: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// checkETag 检查响应是否满足 WithExpectETag 的要求，
+// 服务器忽略 If-Match 时也会比对响应中的 ETag。
+func (o *options) checkETag(resp *http.Response) error {
+	if o.expectETag == "" {
+		return nil
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("%w: server responded %s", ErrETagMismatch, resp.Status)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" && etag != o.expectETag {
+		return fmt.Errorf("%w: got %s, want %s", ErrETagMismatch, etag, o.expectETag)
+	}
+	return nil
+}
+
+// checkRedirect 按 WithMaxRedirects 与 WithSameHostRedirectsOnly 检查重定向，通过后再交给调用者 client 的 next。
+func (o *options) checkRedirect(next func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	limit := o.maxRedirects
+	if limit < 0 {
+		limit = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > limit {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, limit)
+		}
+		if o.sameHostRedirects && req.URL.Host != via[0].URL.Host {
+			return fmt.Errorf("%w: %s -> %s", ErrCrossHostRedirect, via[0].URL.Host, req.URL.Host)
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+}
+
+// WithIgnoreServerFilename 忽略服务器返回的 Content-Disposition 等头部，
+// 文件名只从显式传入的 filename 或 url 中获取，避免服务器决定文件名。
+func WithIgnoreServerFilename() Option {
+	return func(o *options) {
+		o.ignoreServerFilename = true
+	}
+}
+
+// WithExpectedMagic 要求文件以 magic 开头(如 zip 的 "PK"、PDF 的 "%PDF")，
+// 不一致时立即中止下载，用于尽早发现伪装成文件的错误页面。
+func WithExpectedMagic(magic []byte) Option {
+	return func(o *options) {
+		o.expectedMagic = append([]byte(nil), magic...)
+	}
+}
+
+// WithSameHostRedirectsOnly 拒绝跨主机的重定向，信息探测与各分片请求均生效。
+func WithSameHostRedirectsOnly() Option {
+	return func(o *options) {
+		o.sameHostRedirects = true
+	}
+}
+
+// WithMaxRedirects 设置最多跟随的重定向次数，超过时返回 ErrTooManyRedirects，n 为 0 时不跟随重定向。默认为 10。
+// 文件名与大小取自重定向后的最终响应，参见 DownloadResult.FinalURL。
+func WithMaxRedirects(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			o.err = fmt.Errorf("invalid max redirects %d", n)
+			return
+		}
+		o.maxRedirects = n
+	}
+}
+
+// WithExpectETag 要求服务器上的文件 ETag 为 etag，请求会带上 If-Match，
+// 服务器返回 412 或 ETag 不一致时中止下载，保证下载的是指定的版本。
+func WithExpectETag(etag string) Option {
+	return func(o *options) {
+		if etag != "" && !strings.HasPrefix(etag, "W/") && !strings.HasPrefix(etag, `"`) {
+			etag = `"` + etag + `"`
+		}
+		o.expectETag = etag
+	}
+}
+
+// WithLogger 设置日志输出，默认不输出。
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithSizeHeader 在响应缺少 Content-Length 时从名为 name 的头部(如 X-File-Size)读取文件大小。
+func WithSizeHeader(name string) Option {
+	return func(o *options) {
+		o.sizeHeader = name
+	}
+}
+
+// WithURLProvider 设置获取新下载链接的函数，分片请求遇到链接过期(如预签名 URL 失效)时
+// 调用它取得新链接并重试该分片。
+func WithURLProvider(provider func(ctx context.Context) (string, error)) Option {
+	return func(o *options) {
+		o.urlProvider = provider
+	}
+}
+
+// WithURLExpiredFunc 设置判断 403 响应是否为链接过期的函数，返回 false 时视为无权限，不再刷新链接。
+// 默认根据响应体中是否包含 "Request has expired"、"ExpiredToken" 等对象存储的过期错误判断。
+func WithURLExpiredFunc(expired func(resp *http.Response) bool) Option {
+	return func(o *options) {
+		if expired != nil {
+			o.urlExpired = expired
+		}
+	}
+}
+
+// WithChecksums 设置下载完成后需要校验的摘要，键为算法名(md5、sha1、sha256、sha512 等)，
+// 值为十六进制摘要，为空的值不校验。所有算法在一次读取中同时计算，
+// 任一不一致都会删除下载的文件(WithKeepCorrupt 时保留)并返回 *ChecksumError，其中包含期望与实际的摘要。
+func WithChecksums(sums map[string]string) Option {
+	return func(o *options) {
+		for algo, sum := range sums {
+			if _, err := newHash(algo); err != nil {
+				o.err = err
+				return
+			}
+			if strings.TrimSpace(sum) == "" {
+				continue
+			}
+			if o.checksums == nil {
+				o.checksums = make(map[string]string)
+			}
+			o.checksums[algo] = sum
+		}
+	}
+}
+
+// WithChecksum 与 WithChecksums 相同，只校验一种算法，expected 为空时不校验。
+func WithChecksum(algo string, expected string) Option {
+	return WithChecksums(map[string]string{algo: expected})
+}
+
+// WithChecksumManifest 按保存的文件名从 sums(参见 ParseChecksumManifest)中查找摘要并校验，与 WithChecksum 相同。
+// 文件名不在 sums 中时不下载并返回错误。
+func WithChecksumManifest(algo string, sums map[string]string) Option {
+	return func(o *options) {
+		if _, err := newHash(algo); err != nil {
+			o.err = err
+			return
+		}
+		o.manifestAlgo = algo
+		o.manifest = sums
+	}
+}
+
+// withExpectedSize 要求服务器上的文件大小为 size，不一致时返回 ErrSizeMismatch，size < 0 时不检查。
+func withExpectedSize(size int64) Option {
+	return func(o *options) {
+		o.expectedSize = size
+	}
+}
+
+// WithMaxSize 限制文件大小不超过 size 字节：获取到的文件大小超过时不开始下载，
+// 单线程下载时读取超过 size 字节即停止，均返回 ErrTooLarge。DownloadBytes 默认限制为 256 MiB。
+func WithMaxSize(size int64) Option {
+	return func(o *options) {
+		if size <= 0 {
+			o.err = fmt.Errorf("invalid max size %d", size)
+			return
+		}
+		o.maxSize = size
+	}
+}
+
+// checkSize 检查获取到的文件大小是否与 withExpectedSize 一致且不超过 WithMaxSize。
+func (o *options) checkSize(file_size int64) error {
+	if o.maxSize > 0 && file_size > o.maxSize {
+		return fmt.Errorf("%w: server reports %d bytes, limit %d", ErrTooLarge, file_size, o.maxSize)
+	}
+	if o.expectedSize < 0 || file_size < 0 || file_size == o.expectedSize {
+		return nil
+	}
+	return fmt.Errorf("%w: server reports %d bytes, expected %d", ErrSizeMismatch, file_size, o.expectedSize)
+}
+
+// WithKeepCorrupt 在 WithChecksums 校验失败时保留下载的临时文件(<文件名>.download，续传时为 .part)，默认删除。
+func WithKeepCorrupt() Option {
+	return func(o *options) {
+		o.keepCorrupt = true
+	}
+}
+
+// WithAuditLog 为每个完成或失败的分片向 w 追加一行 JSON 格式的 AuditRecord，用于审计。
+// 记录由单独的 goroutine 顺序写入，不会阻塞下载；下载函数返回前会写完所有记录。
+func WithAuditLog(w io.Writer) Option {
+	return func(o *options) {
+		o.auditWriter = w
+	}
+}
+
+// WithAssumeRangeSupport 为 true 时跳过 Accept-Ranges 检查，直接多线程下载(仍从响应头读取大小)，
+// 适用于已知支持 Range 的服务器。若分片请求未返回 206，则改为普通下载。
+func WithAssumeRangeSupport(assume bool) Option {
+	return func(o *options) {
+		o.assumeRangeSupport = assume
+	}
+}
+
+// WithUserAgent 设置所有请求的 User-Agent。
+func WithUserAgent(ua string) Option {
+	return func(o *options) {
+		o.userAgent = ua
+	}
+}
+
+// WithHeader 为所有请求(获取文件信息、各分片及单线程下载)设置请求头，如 Authorization、Referer、Cookie，
+// 可多次使用，同名的头部会被覆盖。也可用于覆盖 User-Agent。
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(http.Header)
+		}
+		o.headers.Set(key, value)
+	}
+}
+
+// WithHeaders 与 WithHeader 相同，一次设置 header 中的所有头部。
+func WithHeaders(header http.Header) Option {
+	return func(o *options) {
+		if o.headers == nil {
+			o.headers = make(http.Header)
+		}
+		for k, v := range header {
+			o.headers[http.CanonicalHeaderKey(k)] = append([]string(nil), v...)
+		}
+	}
+}
+
+// WithCookieJar 使用 jar 保存与发送 Cookie，获取文件信息与各分片的请求共用同一个 jar，
+// 可传入已登录的会话。覆盖 WithHTTPClient 的 Jar。
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) {
+		o.cookieJar = jar
+	}
+}
+
+// WithCookies 为每个请求(包括获取文件信息与各分片)添加 cookies，可多次使用。
+// 与 WithHeader 相同，各分片直接请求重定向后的地址时也会带上。
+func WithCookies(cookies ...*http.Cookie) Option {
+	return func(o *options) {
+		o.cookies = append(o.cookies, cookies...)
+	}
+}
+
+// WithRequestHook 在发送每个请求(获取文件信息、各分片及单线程下载)前调用 fn，可用于签名、添加动态的凭据或改写请求头。
+// fn 在设置 Range、If-Range 等所有请求头之后调用，返回错误时请求不会发送。
+// 可多次使用，按添加的顺序调用。
+func WithRequestHook(fn func(req *http.Request) error) Option {
+	return func(o *options) {
+		prev := o.requestHook
+		o.requestHook = func(req *http.Request) error {
+			if prev != nil {
+				if err := prev(req); err != nil {
+					return err
+				}
+			}
+			return fn(req)
+		}
+	}
+}
+
+// WithResponseHook 在收到每个响应后、检查状态码之前调用 fn，可用于记录日志或检查响应头。
+// fn 不应读取响应体，返回错误时关闭响应并以该错误结束请求。可多次使用，按添加的顺序调用。
+func WithResponseHook(fn func(resp *http.Response) error) Option {
+	return func(o *options) {
+		prev := o.responseHook
+		o.responseHook = func(resp *http.Response) error {
+			if prev != nil {
+				if err := prev(resp); err != nil {
+					return err
+				}
+			}
+			return fn(resp)
+		}
+	}
+}
+
+// WithRateLimit 限制所有线程合计的下载速度，单位为字节/秒，<= 0 表示不限速。
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(o *options) {
+		o.rateLimit = bytesPerSecond
+	}
+}
+
+// WithPartRateLimit 限制每个连接(每个分片或单线程下载)的速度，单位为字节/秒，<= 0 表示不限速。
+// 可与 WithRateLimit 同时使用，分别限制单个连接与所有线程合计的速度。
+func WithPartRateLimit(bytesPerSecond int64) Option {
+	return func(o *options) {
+		o.partRateLimit = bytesPerSecond
+	}
+}
+
+// WithDataCallback 在数据写入文件后以其在文件中的偏移调用 fn。多线程下载时 fn 会被并发调用，
+// data 在 fn 返回后会被复用。fn 返回错误时中止下载。
+func WithDataCallback(fn func(offset int64, data []byte) error) Option {
+	return func(o *options) {
+		o.onData = fn
+	}
+}
+
+// WithShouldProceed 设置一个由各线程定期调用的判断函数，返回 false 时暂停下载，
+// 直到再次返回 true。可用于在电池供电或按流量计费的网络下暂停下载。
+func WithShouldProceed(fn func() bool) Option {
+	return func(o *options) {
+		o.shouldProceed = fn
+	}
+}
+
+// WithCompression 让单线程下载声明支持 br、zstd、gzip 压缩传输，并在写入前解码。
+// 压缩的响应无法按字节范围拼接，多线程下载仍使用未压缩的传输。
+func WithCompression() Option {
+	return func(o *options) {
+		o.compression = true
+	}
+}
+
+// WithKeepEncoded 按原样保存服务器返回的内容，不解码 Content-Encoding。适用于以 Content-Encoding: gzip
+// 返回的 .tar.gz 等文件：保存的是压缩的文件本身，大小与 WithChecksums 均按未解码的内容计算，
+// 编码的响应也可以多线程下载。
+func WithKeepEncoded() Option {
+	return func(o *options) {
+		o.keepEncoded = true
+	}
+}
+
+// WithTimeout 限制整个下载(包括获取文件信息)的最长时间，<= 0 表示不限制。
+// 与 WithResume 一起使用时，超时后会保存进度并返回 ErrTimeoutResumable。
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithKeepPartial 在下载失败或被取消时保留不完整的临时文件 <文件名>.download，默认删除。
+// 不完整的文件不会出现在目标文件名下。
+func WithKeepPartial() Option {
+	return func(o *options) {
+		o.keepPartial = true
+	}
+}
+
+// WithResume 开启断点续传：多线程下载时先写入 <文件名>.part，并在 <文件名>.pdpart 中保存各分片的进度，
+// 再次下载同一文件时只下载缺失的部分。url、大小或 ETag 等发生变化或进度文件损坏时重新下载，
+// 下载完成后删除进度文件，并将 .part 重命名为目标文件名。
+func WithResume() Option {
+	return func(o *options) {
+		o.resume = true
+	}
+}
+
+// WithPieceChecksums 设置每 pieceSize 字节一块的摘要(十六进制，最后一块可以不足 pieceSize)。
+// 多线程下载时按顺序校验已经连续完成的分块，不一致时立即重新下载该块，仍不一致则返回 ErrChecksumMismatch，
+// 不必等到下载完成才发现损坏。pieceSize 即校验的间隔。
+func WithPieceChecksums(algo string, pieceSize int64, sums []string) Option {
+	return func(o *options) {
+		if _, err := newHash(algo); err != nil {
+			o.err = err
+			return
+		}
+		if pieceSize <= 0 {
+			o.err = fmt.Errorf("invalid piece size %d", pieceSize)
+			return
+		}
+		o.pieceAlgo = algo
+		o.pieceSize = pieceSize
+		o.pieceSums = sums
+	}
+}
+
+// WithConnAffinity 设置各分片是否共用连接，默认 ConnShared。
+// 服务器支持 HTTP/2 时，ConnShared 只建立一条连接，ConnPerPart 为每个分片建立一条连接。
+func WithConnAffinity(affinity ConnAffinity) Option {
+	return func(o *options) {
+		o.connAffinity = affinity
+	}
+}
+
+// WithProgress 设置进度回调，下载过程中约每 100 毫秒调用一次，下载结束时再调用一次。
+// 单线程下载时同样有效，文件大小未知时 total 为 -1。
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *options) {
+		o.progressFunc = fn
+	}
+}
+
+// WithProgressJSON 每隔 interval 将进度(百分比、速度、剩余时间、各分片状态)以一行一个 JSON 的格式写入 w，
+// 下载结束时再写入一条 done 为 true 的记录，格式见 ProgressRecord。interval <= 0 时为 1 秒。
+func WithProgressJSON(w io.Writer, interval time.Duration) Option {
+	return func(o *options) {
+		o.progressWriter = w
+		o.progressInterval = interval
+	}
+}
+
+// WithProgressRecords 每隔 interval 以 ProgressRecord(已下载与总字节数、速度、剩余时间、各分片进度)调用 fn，
+// 下载结束时再调用一次 Done 为 true 的记录，单线程与多线程下载均有效。interval <= 0 时为 1 秒，
+// 与 WithProgressJSON 共用间隔。
+func WithProgressRecords(fn func(ProgressRecord), interval time.Duration) Option {
+	return func(o *options) {
+		o.progressRecordFunc = fn
+		o.progressInterval = interval
+	}
+}
+
+// WithRetry 设置分片请求遇到临时错误(连接中断、超时、响应不完整、5xx 等)时最多尝试 maxAttempts 次，
+// 从已写入的位置继续下载。第 n 次重试前等待约 backoff * 2^(n-1)，加入随机抖动，最长 30 秒。
+// 404、416 等错误不重试。maxAttempts <= 1 表示不重试(默认)。
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		if backoff < 0 {
+			o.err = fmt.Errorf("invalid retry backoff %s", backoff)
+			return
+		}
+		o.retryAttempts = maxAttempts
+		o.retryBackoff = backoff
+	}
+}
+
+// WithMaxRetryAfter 限制分片请求遇到 429、503 时遵循 Retry-After 等待的最长时间，默认 5 分钟。
+// 服务器要求等待更久时，fail 为 false 则只等待 d 后重试，为 true 则返回 ErrRetryAfterTooLong。
+func WithMaxRetryAfter(d time.Duration, fail bool) Option {
+	return func(o *options) {
+		if d < 0 {
+			o.err = fmt.Errorf("invalid max retry-after %s", d)
+			return
+		}
+		o.maxRetryAfter = d
+		o.retryAfterFail = fail
+	}
+}
+
+// WithDestinationFunc 在获取文件信息后调用 fn 决定保存的目录与文件名，覆盖 savePath 与 filename 参数。
+// 目录不存在时会被创建，name 为空时使用推断的文件名，fn 返回错误时下载中止。
+func WithDestinationFunc(fn func(info FileInfo) (dir, name string, err error)) Option {
+	return func(o *options) {
+		o.destFunc = fn
+	}
+}
+
+// WithCompletionReport 在下载结束时(包括失败)调用一次 fn，传入耗时、速度、重试次数、连接数及各分片情况的汇总。
+func WithCompletionReport(fn func(Report)) Option {
+	return func(o *options) {
+		o.reportFunc = fn
+	}
+}
+
+// WithMetrics 将下载过程中的字节数、重试次数、失败的分片数、活动的线程数与当前速度汇报给 m。
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithEvents 将下载过程中的事件(开始、获取文件信息、各分片的开始、重试与结束、下载结束)按顺序发送到 ch，
+// 用于展示各分片的状态。事件先放入队列，读取慢时不影响下载，但下载函数返回前会发送完所有事件，
+// 因此需要持续读取 ch。ch 不会被关闭，可由多个下载共用，以 Event.URL 区分。
+func WithEvents(ch chan<- Event) Option {
+	return func(o *options) {
+		o.events = ch
+	}
+}
+
+// WithProtocol 使用 p 下载 scheme(如 "sftp")的 URL，覆盖内置的 "ftp"。p 为 nil 时恢复默认。
+func WithProtocol(scheme string, p Protocol) Option {
+	return func(o *options) {
+		scheme = strings.ToLower(scheme)
+		if scheme == "" || scheme == "http" || scheme == "https" {
+			o.err = fmt.Errorf("invalid protocol scheme %q", scheme)
+			return
+		}
+		protocols := make(map[string]Protocol, len(o.protocols)+1)
+		for k, v := range o.protocols {
+			protocols[k] = v
+		}
+		if p == nil {
+			delete(protocols, scheme)
+		} else {
+			protocols[scheme] = p
+		}
+		o.protocols = protocols
+	}
+}
+
+// WithWorkers 设置 worker_count <= 0 时(以及 Get)使用的最大线程数，覆盖环境变量 PARALLELDOWNLOAD_WORKERS。
+// 实际线程数按文件大小减少，每个分片至少 1 MiB，小于 1 MiB 的文件只用一个连接。
+func WithWorkers(n int64) Option {
+	return func(o *options) {
+		if n <= 0 {
+			o.err = fmt.Errorf("invalid worker count %d", n)
+			return
+		}
+		o.workers = n
+	}
+}
+
+// WithConcurrency 限制同时下载的分片数(即同时打开的连接数)，此时 worker_count 只决定文件分为几个分片。
+// 例如分为 64 个分片以便续传，但只同时下载 8 个，分片完成后再开始下一个。默认所有分片同时下载。
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		if n <= 0 {
+			o.err = fmt.Errorf("invalid concurrency %d", n)
+			return
+		}
+		o.concurrency = n
+	}
+}
+
+// WithChunkSize 将文件分为大小约为 size 的多个分块，此时 worker_count 为同时下载的分块数
+// (已设置 WithConcurrency 时以其为准)。每个线程下载完一个分块后再取下一个，
+// 较快的连接会下载更多分块，某个连接变慢或停滞时只影响其正在下载的分块。
+// 分块数超过 10000 时按 10000 等分。默认值可由环境变量 PARALLELDOWNLOAD_CHUNK_SIZE 设置。
+func WithChunkSize(size int64) Option {
+	return func(o *options) {
+		if size <= 0 {
+			o.err = fmt.Errorf("invalid chunk size %d", size)
+			return
+		}
+		o.chunkSize = size
+	}
+}
+
+// WithWorkStealing 在所有分片都已开始后，让空闲的线程将剩余最多的分片的后一半拆分过来下载，
+// 原分片下载到拆分处为止，剩余不足 2*minSize 字节时不再拆分。可与 WithChunkSize 一起使用。
+// 开启 WithResume 时不拆分。
+func WithWorkStealing(minSize int64) Option {
+	return func(o *options) {
+		if minSize <= 0 {
+			o.err = fmt.Errorf("invalid work stealing size %d", minSize)
+			return
+		}
+		o.stealMinSize = minSize
+	}
+}
+
+// WithMirrors 添加与主地址内容相同的镜像地址，多线程下载时各分片轮流分配给可用的镜像。
+// 某个镜像出错或卡住(参见 WithStallTimeout)后不再使用，其分片剩余的部分改从其他镜像下载。
+// 主地址不可用时使用第一个可用的镜像获取文件信息。各镜像的文件大小必须一致。
+func WithMirrors(urls ...string) Option {
+	return func(o *options) {
+		o.mirrors = append(o.mirrors, urls...)
+	}
+}
+
+// WithStallTimeout 设置分片卡住的判断时间：等待响应或读取响应体超过 d 没有收到数据时取消请求，
+// 从已写入的位置重新请求(使用镜像时换用其他镜像)，每个分片最多重新请求 3 次。默认为 30 秒，d 为 0 时不检测。
+// 暂停、限速、Retry-After 的等待及刷新链接不计入。整个下载的时限参见 WithTimeout。
+func WithStallTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d < 0 {
+			o.err = fmt.Errorf("invalid stall timeout %s", d)
+			return
+		}
+		o.stallTimeout = d
+	}
+}
+
+// WithMinSpeed 在分片累计读取 window 的时间内平均速度低于 bytesPerSecond 时按卡住处理，参见 WithStallTimeout。
+// 只计入等待数据的时间，WithRateLimit 的限速不会触发。
+func WithMinSpeed(bytesPerSecond int64, window time.Duration) Option {
+	return func(o *options) {
+		if bytesPerSecond <= 0 || window <= 0 {
+			o.err = fmt.Errorf("invalid min speed %d in %s", bytesPerSecond, window)
+			return
+		}
+		o.minSpeed = bytesPerSecond
+		o.minSpeedWindow = window
+	}
+}
+
+// WithSavePath 设置 Get 保存文件的目录，默认为当前目录。
+func WithSavePath(path string) Option {
+	return func(o *options) {
+		o.savePath = path
+	}
+}
+
+// WithFilename 设置 Get 保存的文件名，默认根据响应头或 url 推断。
+func WithFilename(name string) Option {
+	return func(o *options) {
+		o.filename = name
+	}
+}
+
+// WithContext 设置 Get 使用的 ctx，ctx 取消时停止下载。其他函数使用各自的 Context 版本。
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithHTTPClient 使用 client 发送所有请求(获取文件信息、分片请求与单线程下载)，
+// 可以借此设置代理、TLS 配置、连接池等。client.Timeout 限制的是每个请求包括读取响应体的时间，
+// 分片较大时应设置得足够长，或改用 WithTimeout 限制整个下载。
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithProxyURL 让所有请求(包括获取文件信息)经过代理 proxy，支持 http://、https:// 与 socks5:// 地址，
+// 用户名密码可写在地址中。默认与 http.DefaultTransport 相同，使用 HTTP_PROXY、HTTPS_PROXY、NO_PROXY 环境变量。
+// 与 WithHTTPClient 一起使用时要求其 Transport 为 *http.Transport。
+func WithProxyURL(proxy string) Option {
+	return func(o *options) {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			o.err = fmt.Errorf("invalid proxy url %q: %w", proxy, err)
+			return
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			o.err = fmt.Errorf("invalid proxy url %q: unsupported scheme %q", proxy, u.Scheme)
+			return
+		}
+		o.proxy = u
+	}
+}
+
+// WithTLSConfig 使用 cfg 的副本作为 TLS 配置，WithRootCAs 等选项在其基础上修改。
+// 与 WithHTTPClient 一起使用时要求其 Transport 为 *http.Transport。
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithRootCAs 使用 pool 验证服务器证书，用于自签名 CA 的内部服务器。
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(o *options) {
+		o.rootCAs = pool
+	}
+}
+
+// WithClientCertificate 在服务器要求时提供客户端证书(mTLS)，可多次使用。
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(o *options) {
+		o.clientCerts = append(o.clientCerts, cert)
+	}
+}
+
+// WithInsecureSkipVerify 不验证服务器证书。只应用于无法配置 CA 的内部服务器，连接可被中间人劫持。
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.insecureSkipVerify = true
+	}
+}
+
+// WithMaxConnsPerHost 限制同一主机的连接数(包括正在建立与空闲的)，超过时请求等待已有连接空闲。
+// 所有分片共用一个连接池，默认不限制。与 WithHTTPClient 一起使用时要求其 Transport 为 *http.Transport。
+func WithMaxConnsPerHost(n int) Option {
+	return func(o *options) {
+		if n <= 0 {
+			o.err = fmt.Errorf("invalid max conns per host %d", n)
+			return
+		}
+		o.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConns 设置每个主机保留的空闲连接数与空闲连接的超时(timeout 为 0 时不修改)。
+// http.DefaultTransport 每个主机只保留 2 条空闲连接，分块较多(参见 WithChunkSize)时
+// 应设为不少于线程数，使下载完一个分块的连接被下一个分块复用。
+func WithIdleConns(perHost int, timeout time.Duration) Option {
+	return func(o *options) {
+		if perHost <= 0 || timeout < 0 {
+			o.err = fmt.Errorf("invalid idle conns %d, timeout %v", perHost, timeout)
+			return
+		}
+		o.maxIdlePerHost = perHost
+		o.idleTimeout = timeout
+	}
+}
+
+// WithTee 将下载的数据按文件顺序同时写入 w(如计算哈希、上传)，可多次使用添加多个 w。
+// w 较慢时下载会随之变慢。w 返回错误时下载失败。
+func WithTee(w io.Writer) Option {
+	return func(o *options) {
+		o.tees = append(o.tees, w)
+	}
+}
+
+// WithTeeBuffer 设置乱序到达、等待按顺序写入 tee 的数据最多缓存的字节数，默认 8 MiB。
+func WithTeeBuffer(size int64) Option {
+	return func(o *options) {
+		if size <= 0 {
+			o.err = fmt.Errorf("invalid tee buffer size %d", size)
+			return
+		}
+		o.teeBuffer = size
+	}
+}
+
+// WithBufferSize 设置各分片读取响应体的缓冲区大小，默认 32 KiB。
+// 带宽很高时可适当调大以减少读取次数，缓冲区在分片之间复用。
+// 读取的数据在缓冲区填满(或分片结束、出错)时才写入，进度与回调按缓冲区更新，很慢的链接上可适当调小。
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		if size <= 0 {
+			o.err = fmt.Errorf("invalid buffer size %d", size)
+			return
+		}
+		o.bufferSize = size
+	}
+}
+
+// WithShrinkPolicy 设置续传时远程文件变小的处理方式，默认 ShrinkRestart。
+func WithShrinkPolicy(policy ShrinkPolicy) Option {
+	return func(o *options) {
+		o.shrinkPolicy = policy
+	}
+}
+
+// WithFallbackPolicy 设置无法多线程下载时是否回退到单线程下载，默认 FallbackAlways。
+// 实际使用的方式参见 DownloadResult.Parallel 与 DownloadResult.FallbackReason。
+func WithFallbackPolicy(policy FallbackPolicy) Option {
+	return func(o *options) {
+		if policy < FallbackAlways || policy > FallbackNever {
+			o.err = fmt.Errorf("invalid fallback policy %s", policy)
+			return
+		}
+		o.fallbackPolicy = policy
+	}
+}
+
+// WithExistPolicy 设置保存路径已经存在文件时的处理方式，默认 ExistOverwrite。
+// 在创建或截断文件之前按最终确定的文件名判断，便于重复执行批量下载。
+func WithExistPolicy(policy ExistPolicy) Option {
+	return func(o *options) {
+		o.existPolicy = policy
+	}
+}
+
+// WithSymlinkPolicy 设置保存路径是符号链接时的处理方式，默认 SymlinkFollow。
+func WithSymlinkPolicy(policy SymlinkPolicy) Option {
+	return func(o *options) {
+		o.symlinkPolicy = policy
+	}
+}
+
+// WithFS 将文件保存到 fsys 而不是本地文件系统，如内存文件系统或对象存储的适配器。
+// 临时文件、续传进度(.pdpart)与重命名都在 fsys 中进行，WithSymlinkPolicy 不再生效。传入 nil 时恢复默认。
+func WithFS(fsys FS) Option {
+	return func(o *options) {
+		o.fs = fsys
+	}
+}
@@ -0,0 +1,102 @@
+package paralleldownload
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSameHostRedirectsOnly(t *testing.T) {
+	data := testContent(10000)
+	other := newServer(t, serveData(data))
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/f.bin", http.StatusFound)
+		case "/cross":
+			http.Redirect(w, r, other.URL+"/f.bin", http.StatusFound)
+		case "/cross-get":
+			// 只有分片的 GET 请求被重定向到其他主机
+			if r.Method == http.MethodGet {
+				http.Redirect(w, r, other.URL+"/f.bin", http.StatusFound)
+				return
+			}
+			serveData(data)(w, r)
+		default:
+			serveData(data)(w, r)
+		}
+	}))
+
+	dir := t.TempDir()
+	if err := ParallelDownload(s.URL+"/same", dir, "same.bin", 3, WithSameHostRedirectsOnly()); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "same.bin"), data)
+
+	err := ParallelDownload(s.URL+"/cross", dir, "cross.bin", 3, WithSameHostRedirectsOnly())
+	if !errors.Is(err, ErrCrossHostRedirect) {
+		t.Fatalf("info request: err = %v, want ErrCrossHostRedirect", err)
+	}
+	err = ParallelDownload(s.URL+"/cross-get", dir, "cross-get.bin", 3, WithSameHostRedirectsOnly())
+	if !errors.Is(err, ErrCrossHostRedirect) {
+		t.Fatalf("part request: err = %v, want ErrCrossHostRedirect", err)
+	}
+
+	// 不设置时跟随跨主机的重定向
+	if err := ParallelDownload(s.URL+"/cross", dir, "allowed.bin", 3); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "allowed.bin"), data)
+}
+
+func TestExpectETag(t *testing.T) {
+	data := testContent(10000)
+	var ifMatch []string
+	var mu sync.Mutex
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		serveData(data)(w, r)
+	}))
+
+	dir := t.TempDir()
+	if err := ParallelDownload(s.URL+"/f.bin", dir, "match.bin", 3, WithExpectETag("v1")); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "match.bin"), data)
+	if len(ifMatch) == 0 || ifMatch[0] != `"v1"` {
+		t.Fatalf("If-Match = %q, want quoted etag", ifMatch)
+	}
+
+	err := ParallelDownload(s.URL+"/f.bin", dir, "mismatch.bin", 3, WithExpectETag("v2"))
+	if !errors.Is(err, ErrETagMismatch) {
+		t.Fatalf("parallel: err = %v, want ErrETagMismatch", err)
+	}
+	err = Download(s.URL+"/f.bin", dir, "mismatch.bin", WithExpectETag("v2"))
+	if !errors.Is(err, ErrETagMismatch) {
+		t.Fatalf("single stream: err = %v, want ErrETagMismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mismatch.bin")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("mismatched file written: %v", err)
+	}
+}
+
+func TestWithProtocolCopiesMap(t *testing.T) {
+	p := ftpProtocol{}
+	base := newOptions([]Option{WithProtocol("sftp", p)})
+	// 在共用同一个 map 的配置上恢复默认，不能影响原来的配置
+	o := newOptions(nil)
+	o.protocols = base.protocols
+	WithProtocol("SFTP", nil)(o)
+	if o.protocolFor("sftp") != nil {
+		t.Fatal("protocol not removed")
+	}
+	if base.protocolFor("sftp") == nil {
+		t.Fatal("removing a protocol modified the shared map")
+	}
+}
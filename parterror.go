@@ -0,0 +1,88 @@
+package paralleldownload
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PartError 为一个分片下载失败的错误，Start 与 End 为分片的字节范围(均包含在内)。
+type PartError struct {
+	Part  int64
+	Start int64
+	End   int64
+	Err   error
+}
+
+func (e *PartError) Error() string {
+	return fmt.Sprintf("%v (bytes %d-%d)", e.Err, e.Start, e.End)
+}
+
+func (e *PartError) Unwrap() error {
+	return e.Err
+}
+
+// PartsError 汇总多线程下载中所有失败的分片，按分片序号排列。
+// errors.Is 与 errors.As 会检查其中每个分片的错误。
+type PartsError struct {
+	Parts []*PartError
+}
+
+func (e *PartsError) Error() string {
+	if len(e.Parts) == 1 {
+		return e.Parts[0].Error()
+	}
+	msgs := make([]string, len(e.Parts))
+	for i, p := range e.Parts {
+		msgs[i] = p.Error()
+	}
+	return fmt.Sprintf("%d parts failed: %s", len(e.Parts), strings.Join(msgs, "; "))
+}
+
+// Unwrap 返回第一个失败分片的错误。
+func (e *PartsError) Unwrap() error {
+	return e.Parts[0]
+}
+
+func (e *PartsError) Is(target error) bool {
+	for _, p := range e.Parts[1:] {
+		if errors.Is(p, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *PartsError) As(target any) bool {
+	for _, p := range e.Parts[1:] {
+		if errors.As(p, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// partErrors 并发收集各分片的错误。
+type partErrors struct {
+	mu    sync.Mutex
+	parts []*PartError
+}
+
+func (c *partErrors) add(p part, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parts = append(c.parts, &PartError{Part: p.num, Start: p.start, End: p.end, Err: err})
+}
+
+// err 返回汇总的错误，没有分片失败时返回 nil。
+func (c *partErrors) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.parts) == 0 {
+		return nil
+	}
+	sort.Slice(c.parts, func(i, j int) bool { return c.parts[i].Part < c.parts[j].Part })
+	return &PartsError{Parts: c.parts}
+}
@@ -0,0 +1,50 @@
+package paralleldownload
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// shouldProceedInterval 为调用 WithShouldProceed 判断函数的最短间隔，暂停时也按此间隔轮询。
+const shouldProceedInterval = 500 * time.Millisecond
+
+// gatedReader 定期调用 shouldProceed，返回 false 时暂停读取直到其返回 true。
+// 暂停期间连接保持打开，不会被主动断开。
+type gatedReader struct {
+	ctx           context.Context
+	r             io.Reader
+	shouldProceed func() bool
+	lastCheck     time.Time
+}
+
+func (o *options) gateReader(ctx context.Context, r io.Reader) io.Reader {
+	if o.shouldProceed == nil {
+		return r
+	}
+	return &gatedReader{ctx: ctx, r: r, shouldProceed: o.shouldProceed}
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	if time.Since(g.lastCheck) >= shouldProceedInterval {
+		if err := waitProceed(g.ctx, g.shouldProceed); err != nil {
+			return 0, err
+		}
+		g.lastCheck = time.Now()
+	}
+	return g.r.Read(p)
+}
+
+// waitProceed 阻塞直到 shouldProceed 返回 true 或 ctx 结束。
+func waitProceed(ctx context.Context, shouldProceed func() bool) error {
+	for !shouldProceed() {
+		timer := time.NewTimer(shouldProceedInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShouldProceed(t *testing.T) {
+	data := testContent(40000)
+	var gets atomic.Int32
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.Header.Get("Range"), "bytes=") && r.Header.Get("Range") != "bytes=0-0" {
+			gets.Add(1)
+		}
+		serveData(data)(w, r)
+	}))
+
+	var proceed atomic.Bool
+	var calls, received atomic.Int64
+	shouldProceed := func() bool {
+		calls.Add(1)
+		return proceed.Load()
+	}
+	onData := func(offset int64, p []byte) error {
+		received.Add(int64(len(p)))
+		return nil
+	}
+	done := make(chan error, 1)
+	var res *DownloadResult
+	go func() {
+		var err error
+		res, err = ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4,
+			WithShouldProceed(shouldProceed), WithDataCallback(onData))
+		done <- err
+	}()
+
+	time.Sleep(1200 * time.Millisecond)
+	if n := received.Load(); n != 0 {
+		t.Fatalf("received %d bytes while paused", n)
+	}
+	// 暂停时按 shouldProceedInterval 轮询，不会空转
+	if n := calls.Load(); n == 0 || n > 20 {
+		t.Fatalf("predicate called %d times during the pause", n)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("download finished while paused: %v", err)
+	default:
+	}
+
+	proceed.Store(true)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not resume")
+	}
+	checkFile(t, res.Path, data)
+	// 暂停期间保持连接，每个分片只请求一次
+	if n := gets.Load(); n != 4 {
+		t.Fatalf("%d part requests, want 4", n)
+	}
+}
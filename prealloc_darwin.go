@@ -0,0 +1,23 @@
+//go:build darwin
+
+package paralleldownload
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// preallocate 用 F_PREALLOCATE 为 f 分配 size 字节的磁盘空间，优先分配连续的空间，再 Truncate 到 size。
+func preallocate(f *os.File, size int64) error {
+	fst := syscall.Fstore_t{Flags: syscall.F_ALLOCATECONTIG, Posmode: syscall.F_PEOFPOSMODE, Length: size}
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_PREALLOCATE, uintptr(unsafe.Pointer(&fst)))
+	if errno != 0 {
+		fst.Flags = syscall.F_ALLOCATEALL
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), syscall.F_PREALLOCATE, uintptr(unsafe.Pointer(&fst)))
+	}
+	if errno == syscall.ENOSPC {
+		return errno
+	}
+	return f.Truncate(size)
+}
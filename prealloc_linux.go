@@ -0,0 +1,18 @@
+//go:build linux
+
+package paralleldownload
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// preallocate 用 fallocate 为 f 分配 size 字节的磁盘空间，文件系统不支持时改为 Truncate。
+func preallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return f.Truncate(size)
+	}
+	return err
+}
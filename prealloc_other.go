@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package paralleldownload
+
+import "os"
+
+// preallocate 将 f 扩展为 size 字节(Windows 上为 SetEndOfFile)。
+func preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
@@ -0,0 +1,302 @@
+package paralleldownload
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultProgressInterval 为 WithProgressJSON 未指定间隔时两条进度记录之间的最短间隔。
+const defaultProgressInterval = time.Second
+
+// progressFuncInterval 为调用 WithProgress 回调的间隔。
+const progressFuncInterval = 100 * time.Millisecond
+
+// ProgressFunc 接收已下载的字节数与文件总大小，总大小未知时为 -1。
+type ProgressFunc func(downloaded, total int64)
+
+// ProgressRecord 为 WithProgressJSON 输出的一条进度记录。
+type ProgressRecord struct {
+	Time       time.Time `json:"time"`
+	Downloaded int64     `json:"downloaded"`
+	// Total 为文件大小，未知时为 -1
+	Total int64 `json:"total"`
+	// Percent 为 0 到 100 的完成百分比，Total 未知时为 -1
+	Percent float64 `json:"percent"`
+	// Speed 为距上一条记录的平均速度，单位字节每秒
+	Speed float64 `json:"speed"`
+	// ETA 为按 Speed 估计的剩余秒数，无法估计时为 -1
+	ETA   float64        `json:"eta"`
+	Parts []PartProgress `json:"parts,omitempty"`
+	// Done 为 true 表示这是最后一条记录，Error 为下载失败的原因
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+}
+
+// PartProgress 为一个分片的进度，State 为 pending、downloading、done 或 failed。
+type PartProgress struct {
+	Part       int64  `json:"part"`
+	Start      int64  `json:"start"`
+	End        int64  `json:"end"`
+	Downloaded int64  `json:"downloaded"`
+	State      string `json:"state"`
+}
+
+const (
+	partPending int32 = iota
+	partDownloading
+	partDone
+	partFailed
+)
+
+var partStates = [...]string{"pending", "downloading", "done", "failed"}
+
+type partProgress struct {
+	p          part
+	downloaded atomic.Int64
+	state      atomic.Int32
+}
+
+// progressReporter 按固定间隔调用 ProgressFunc，并将进度以一行一个 JSON 的格式写入 w，
+// 写入失败时不再输出 JSON，不影响下载。
+type progressReporter struct {
+	fn         ProgressFunc
+	enc        *json.Encoder
+	recordFunc func(ProgressRecord)
+	tick       time.Duration
+	jsonTicks  int // 每 jsonTicks 个 tick 输出一条记录
+	total      int64
+	base       int64 // 开始前已经完成的字节数(续传)
+	downloaded atomic.Int64
+	parts      []*partProgress
+	index      map[int64]*partProgress
+
+	mu       sync.Mutex
+	failed   bool
+	lastTime time.Time
+	lastSize int64
+	// 供 Handle.Progress 使用的速度，每隔约 1 秒按这段时间内的下载量更新
+	sampleTime time.Time
+	sampleSize int64
+	speed      float64
+	sampled    bool
+	finished   bool
+	err        error
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// newProgress 创建并开始输出进度，total 未知时为 -1。
+// 未设置 WithProgress、WithProgressJSON、WithProgressRecords 且不是 Handle 的下载时返回 nil。
+func (o *options) newProgress(total int64, parts []part) *progressReporter {
+	if o.progressFunc == nil && o.progressWriter == nil && o.progressRecordFunc == nil && o.handle == nil {
+		return nil
+	}
+	now := time.Now()
+	r := &progressReporter{
+		fn:         o.progressFunc,
+		recordFunc: o.progressRecordFunc,
+		total:      total,
+		index:      make(map[int64]*partProgress, len(parts)),
+		lastTime:   now,
+		sampleTime: now,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	interval := o.progressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	r.tick = interval
+	if r.fn != nil && progressFuncInterval < r.tick {
+		r.tick = progressFuncInterval
+	}
+	if o.progressWriter != nil {
+		r.enc = json.NewEncoder(o.progressWriter)
+	}
+	r.jsonTicks = int((interval + r.tick - 1) / r.tick)
+	var pending int64
+	for _, p := range parts {
+		pp := &partProgress{p: p}
+		r.parts = append(r.parts, pp)
+		r.index[p.num] = pp
+		pending += p.end - p.start + 1
+	}
+	if total > 0 && len(parts) > 0 {
+		r.base = total - pending
+	}
+	r.sampleSize = r.base
+	r.lastSize = r.base
+	o.handle.setProgress(r)
+	go r.run()
+	return r
+}
+
+func (r *progressReporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.tick)
+	defer ticker.Stop()
+	for ticks := 1; ; ticks++ {
+		select {
+		case <-ticker.C:
+			r.notify()
+			r.sample()
+			if ticks%r.jsonTicks == 0 {
+				r.emit(false, nil)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// add 记录第 num 个分片新写入的 n 字节，num 为 -1 表示单线程下载。
+func (r *progressReporter) add(num int64, n int64) {
+	if r == nil {
+		return
+	}
+	r.downloaded.Add(n)
+	if pp, ok := r.index[num]; ok {
+		pp.downloaded.Add(n)
+	}
+}
+
+func (r *progressReporter) setState(num int64, state int32) {
+	if r == nil {
+		return
+	}
+	if pp, ok := r.index[num]; ok {
+		pp.state.Store(state)
+	}
+}
+
+// finish 停止定时输出，并输出最后一条记录。
+func (r *progressReporter) finish(err error) {
+	if r == nil {
+		return
+	}
+	close(r.stop)
+	<-r.done
+	r.mu.Lock()
+	r.finished, r.err = true, err
+	r.mu.Unlock()
+	r.notify()
+	r.emit(true, err)
+}
+
+// notify 调用 ProgressFunc。
+func (r *progressReporter) notify() {
+	if r.fn == nil {
+		return
+	}
+	total := r.total
+	if total <= 0 {
+		total = -1
+	}
+	r.fn(r.base+r.downloaded.Load(), total)
+}
+
+// sample 距上次采样约 1 秒后更新 Handle.Progress 使用的速度。
+func (r *progressReporter) sample() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(r.sampleTime)
+	if elapsed < time.Second {
+		return
+	}
+	downloaded := r.base + r.downloaded.Load()
+	r.speed = float64(downloaded-r.sampleSize) / elapsed.Seconds()
+	r.sampleTime, r.sampleSize = now, downloaded
+	r.sampled = true
+}
+
+// snapshot 返回当前的进度，Speed 为最近约 1 秒的平均速度。
+func (r *progressReporter) snapshot() ProgressRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	rec := r.record(now, r.finished, r.err)
+	if r.sampled {
+		rec.Speed = r.speed
+	} else if elapsed := now.Sub(r.sampleTime).Seconds(); elapsed > 0 {
+		rec.Speed = float64(rec.Downloaded-r.sampleSize) / elapsed
+	}
+	rec.ETA = r.eta(rec)
+	return rec
+}
+
+// emit 输出一条 JSON 记录并调用 WithProgressRecords 的回调。
+func (r *progressReporter) emit(done bool, err error) {
+	if r.enc == nil && r.recordFunc == nil {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	rec := r.record(now, done, err)
+	if elapsed := now.Sub(r.lastTime).Seconds(); elapsed > 0 {
+		rec.Speed = float64(rec.Downloaded-r.lastSize) / elapsed
+	}
+	rec.ETA = r.eta(rec)
+	r.lastTime, r.lastSize = now, rec.Downloaded
+	if r.enc != nil && !r.failed {
+		if err := r.enc.Encode(rec); err != nil {
+			r.failed = true
+		}
+	}
+	r.mu.Unlock()
+	// 回调可能调用 Handle.Progress，不能持有锁
+	if r.recordFunc != nil {
+		r.recordFunc(rec)
+	}
+}
+
+// record 生成当前进度的记录，不含 Speed 与 ETA，调用者需持有 r.mu。
+func (r *progressReporter) record(now time.Time, done bool, err error) ProgressRecord {
+	downloaded := r.base + r.downloaded.Load()
+	rec := ProgressRecord{
+		Time:       now,
+		Downloaded: downloaded,
+		Total:      r.total,
+		Percent:    -1,
+		ETA:        -1,
+		Done:       done,
+	}
+	if r.total <= 0 {
+		rec.Total = -1
+	} else {
+		rec.Percent = float64(downloaded) * 100 / float64(r.total)
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	for _, pp := range r.parts {
+		rec.Parts = append(rec.Parts, PartProgress{
+			Part:       pp.p.num,
+			Start:      pp.p.start,
+			End:        pp.p.end,
+			Downloaded: pp.downloaded.Load(),
+			State:      partStates[pp.state.Load()],
+		})
+	}
+	return rec
+}
+
+// eta 按 rec.Speed 估计剩余秒数，无法估计时为 -1。
+func (r *progressReporter) eta(rec ProgressRecord) float64 {
+	if rec.Speed > 0 && r.total > 0 {
+		return float64(r.total-rec.Downloaded) / rec.Speed
+	}
+	return -1
+}
+
+// progressWriter 统计单线程下载写入的字节数。
+type progressWriter struct {
+	r *progressReporter
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	w.r.add(-1, int64(len(p)))
+	return len(p), nil
+}
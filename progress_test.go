@@ -0,0 +1,65 @@
+package paralleldownload
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestProgressJSON(t *testing.T) {
+	data := testContent(1 << 20)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 每个连接约 4 MB/s，下载持续约 60ms
+		http.ServeContent(w, r, "", time.Time{}, throttledReader{bytes.NewReader(data), 4 << 10})
+	}))
+	var out bytes.Buffer
+	if err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 4, WithProgressJSON(&out, 10*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	var records []ProgressRecord
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var raw map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &raw); err != nil {
+			t.Fatalf("malformed line %q: %v", scanner.Text(), err)
+		}
+		for _, key := range []string{"time", "downloaded", "total", "percent", "speed", "eta", "done"} {
+			if _, ok := raw[key]; !ok {
+				t.Fatalf("line %q has no %q", scanner.Text(), key)
+			}
+		}
+		var rec ProgressRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) < 3 {
+		t.Fatalf("got %d records, want periodic records plus the final one", len(records))
+	}
+	var prev ProgressRecord
+	for i, rec := range records {
+		if rec.Total != int64(len(data)) || len(rec.Parts) != 4 {
+			t.Fatalf("record %d: total = %d, parts = %d", i, rec.Total, len(rec.Parts))
+		}
+		if rec.Downloaded < prev.Downloaded || rec.Percent < prev.Percent || rec.Time.Before(prev.Time) {
+			t.Fatalf("record %d went backwards: %+v after %+v", i, rec, prev)
+		}
+		if rec.Done != (i == len(records)-1) {
+			t.Fatalf("record %d: done = %v", i, rec.Done)
+		}
+		prev = rec
+	}
+	if prev.Downloaded != int64(len(data)) || prev.Percent != 100 || prev.Error != "" {
+		t.Fatalf("final record = %+v", prev)
+	}
+	for _, p := range prev.Parts {
+		if p.State != "done" || p.Downloaded != p.End-p.Start+1 {
+			t.Fatalf("final part = %+v", p)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package paralleldownload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Protocol 为 HTTP 以外的协议提供下载，按 URL 的 scheme 选择，参见 WithProtocol。
+// 支持从任意位置开始读取的协议可以多线程下载，否则回退到单线程下载。
+type Protocol interface {
+	// Stat 返回文件大小(未知时为 -1)，seekable 表示 Open 是否支持 offset > 0
+	Stat(ctx context.Context, u *url.URL) (size int64, seekable bool, err error)
+	// Open 返回从 offset 开始的文件内容及文件大小(未知时为 -1)，读取应在 ctx 结束时中断。
+	// 不支持 offset > 0 时返回 ErrRangeNotSupported
+	Open(ctx context.Context, u *url.URL, offset int64) (body io.ReadCloser, size int64, err error)
+}
+
+// protocolFor 返回 scheme 对应的 Protocol，HTTP(S) 返回 nil。
+func (o *options) protocolFor(scheme string) Protocol {
+	if p, ok := o.protocols[scheme]; ok {
+		return p
+	}
+	if scheme == "ftp" {
+		return ftpProtocol{}
+	}
+	return nil
+}
+
+// roundTrip 将下载用到的 HEAD 与带 Range 的 GET 请求转换为对 p 的调用，响应与支持 Range 的 HTTP 服务器相同，
+// 下载的其余部分(分片、重试、续传、校验等)不需要区分协议。
+func roundTrip(p Protocol, req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	status := func(code int) *http.Response {
+		resp.StatusCode = code
+		resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		return resp
+	}
+	if req.Method == http.MethodHead {
+		size, seekable, err := p.Stat(req.Context(), req.URL)
+		if err != nil {
+			return nil, err
+		}
+		if seekable {
+			resp.Header.Set("Accept-Ranges", "bytes")
+		}
+		resp.ContentLength = size
+		if size >= 0 {
+			resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		return status(http.StatusOK), nil
+	}
+	if req.Method != http.MethodGet {
+		return status(http.StatusMethodNotAllowed), nil
+	}
+	start, end, ranged := parseRange(req.Header.Get("Range"))
+	if ranged && start == 0 {
+		// 获取文件信息时以 "bytes=0-0" 检查是否支持 Range，不支持时忽略 Range，由调用方回退到单线程下载
+		if _, seekable, err := p.Stat(req.Context(), req.URL); err != nil {
+			return nil, err
+		} else if !seekable {
+			ranged = false
+		}
+	}
+	body, size, err := p.Open(req.Context(), req.URL, start)
+	if err != nil {
+		return nil, err
+	}
+	if !ranged {
+		resp.Body = body
+		resp.ContentLength = size
+		if size >= 0 {
+			resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		}
+		return status(http.StatusOK), nil
+	}
+	if size >= 0 && start >= size {
+		body.Close()
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return status(http.StatusRequestedRangeNotSatisfiable), nil
+	}
+	total := "*"
+	if size >= 0 {
+		total = strconv.FormatInt(size, 10)
+		if end < 0 || end >= size {
+			end = size - 1
+		}
+	} else if end < 0 {
+		body.Close()
+		return nil, fmt.Errorf("%w: size of %s is unknown", ErrRangeNotSupported, req.URL.Redacted())
+	}
+	resp.ContentLength = end - start + 1
+	resp.Header.Set("Accept-Ranges", "bytes")
+	resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, end, total))
+	resp.Body = limitedBody{Reader: io.LimitReader(body, resp.ContentLength), Closer: body}
+	return status(http.StatusPartialContent), nil
+}
+
+// parseRange 解析 "bytes=start-end" 与 "bytes=start-"，后者 end 为 -1，不支持多个范围与后缀范围。
+func parseRange(header string) (start, end int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return 0, 0, false
+	}
+	spec := strings.TrimPrefix(header, "bytes=")
+	if strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	from, to, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(from, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	if to == "" {
+		return start, -1, true
+	}
+	end, err = strconv.ParseInt(to, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// limitedBody 只读取范围内的数据，关闭时关闭原来的连接。
+type limitedBody struct {
+	io.Reader
+	io.Closer
+}
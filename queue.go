@@ -0,0 +1,120 @@
+package paralleldownload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// managerState 为 Manager.Load 保存的任务列表。
+type managerState struct {
+	Items []stateItem `json:"items"`
+}
+
+// stateItem 为保存的一个任务，Status 为 ItemStatus.String() 的值。
+type stateItem struct {
+	URL      string `json:"url"`
+	SavePath string `json:"save_path"`
+	Filename string `json:"filename,omitempty"`
+	Workers  int64  `json:"workers"`
+	Status   string `json:"status"`
+	// Path 为下载成功时保存文件的路径
+	Path string `json:"path,omitempty"`
+	// Error 为下载失败的原因
+	Error string `json:"error,omitempty"`
+}
+
+// Load 从 path(JSON)恢复任务列表，之后每个任务的状态变化都保存到 path，用于进程崩溃或重启后继续下载。
+// 排队中与下载中的任务重新加入队列并返回，以 WithResume 从中断处继续(各分片的进度保存在文件旁的 .pdpart 中)；
+// 已完成、失败与被 Item.Cancel 取消的任务保留在文件中，不再下载。Manager.Cancel 视为中断，
+// 其取消的任务下次 Load 时继续。path 不存在时从空列表开始。
+// 恢复的任务只使用 NewManager 的 Option，Add 传入的 Option 不会保存。应在 Add 之前调用，且只能调用一次。
+func (m *Manager) Load(path string) ([]*Item, error) {
+	var state managerState
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("parse manager state %s: %w", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	m.mu.Lock()
+	if m.statePath != "" {
+		m.mu.Unlock()
+		return nil, errors.New("manager state already loaded")
+	}
+	m.statePath = path
+	m.logger = newOptions(m.opts).logger
+	var pending []stateItem
+	for _, s := range state.Items {
+		switch s.Status {
+		case ItemQueued.String(), ItemRunning.String():
+			pending = append(pending, s)
+		default:
+			m.history = append(m.history, s)
+		}
+	}
+	m.mu.Unlock()
+	items := make([]*Item, 0, len(pending))
+	for _, s := range pending {
+		items = append(items, m.Add(s.URL, s.SavePath, s.Filename, s.Workers))
+	}
+	m.save()
+	return items, nil
+}
+
+// save 将所有任务的状态写入 Load 的文件，没有调用 Load 时不做任何事。
+func (m *Manager) save() {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	m.mu.Lock()
+	path := m.statePath
+	state := managerState{Items: append([]stateItem(nil), m.history...)}
+	for _, it := range m.items {
+		state.Items = append(state.Items, it.state())
+	}
+	m.mu.Unlock()
+	if path == "" {
+		return
+	}
+	if err := writeState(path, state); err != nil {
+		m.logger.Warn("save manager state failed", "path", path, "err", err)
+	}
+}
+
+// writeState 先写入临时文件再重命名，崩溃时不会留下不完整的文件。
+func writeState(path string, state managerState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (it *Item) state() stateItem {
+	it.mu.Lock()
+	status, canceled := it.status, it.canceled
+	it.mu.Unlock()
+	s := stateItem{URL: it.URL, SavePath: it.savePath, Filename: it.filename, Workers: it.workers, Status: status.String()}
+	switch status {
+	case ItemCanceled:
+		if !canceled {
+			// 被 Manager.Cancel 中断，下次 Load 时继续
+			s.Status = ItemQueued.String()
+		}
+	case ItemDone:
+		if it.h.result != nil {
+			s.Path = it.h.result.Path
+		}
+	case ItemFailed:
+		s.Error = it.h.err.Error()
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package paralleldownload
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// readState 读取 Manager.Load 保存的状态文件，返回 URL 到任务的映射。
+func readState(t *testing.T, path string) map[string]stateItem {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state managerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	items := make(map[string]stateItem, len(state.Items))
+	for _, s := range state.Items {
+		items[s.URL] = s
+	}
+	return items
+}
+
+func TestManagerLoad(t *testing.T) {
+	data := testContent(50000)
+	var healthy atomic.Bool
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 恢复之前，除 /done.bin 外的下载请求一直挂起
+		if r.Method == http.MethodGet && r.URL.Path != "/done.bin" && !healthy.Load() {
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	doneURL, canceledURL, pendingURL := s.URL+"/done.bin", s.URL+"/canceled.bin", s.URL+"/pending.bin"
+
+	m := NewManager(3, nil)
+	t.Cleanup(m.Cancel)
+	if items, err := m.Load(statePath); err != nil || len(items) != 0 {
+		t.Fatalf("load missing state: %d items, err %v", len(items), err)
+	}
+	done := m.Add(doneURL, dir, "", 2)
+	canceled := m.Add(canceledURL, dir, "", 2)
+	pending := m.Add(pendingURL, dir, "", 2)
+	if _, err := done.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "items running", func() bool {
+		return canceled.Status() == ItemRunning && pending.Status() == ItemRunning
+	})
+	canceled.Cancel()
+	canceled.Wait()
+	// Manager.Cancel 视为中断，任务保存为排队中
+	m.Cancel()
+	m.Wait()
+
+	state := readState(t, statePath)
+	if s := state[doneURL]; s.Status != ItemDone.String() || s.Path != filepath.Join(dir, "done.bin") {
+		t.Fatalf("done item saved as %+v", s)
+	}
+	if s := state[canceledURL]; s.Status != ItemCanceled.String() {
+		t.Fatalf("item canceled by Item.Cancel saved as %q", s.Status)
+	}
+	if s := state[pendingURL]; s.Status != ItemQueued.String() {
+		t.Fatalf("item canceled by Manager.Cancel saved as %q", s.Status)
+	}
+
+	// 重启后只恢复未完成的任务并下载完成
+	healthy.Store(true)
+	m2 := NewManager(2, nil)
+	t.Cleanup(m2.Cancel)
+	items, err := m2.Load(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].URL != pendingURL {
+		t.Fatalf("resumed %d items, want only %s", len(items), pendingURL)
+	}
+	res, err := items[0].Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	m2.Wait()
+
+	state = readState(t, statePath)
+	if len(state) != 3 {
+		t.Fatalf("state has %d items, want 3", len(state))
+	}
+	if s := state[pendingURL]; s.Status != ItemDone.String() || s.Path != res.Path {
+		t.Fatalf("resumed item saved as %+v", s)
+	}
+	if s := state[canceledURL]; s.Status != ItemCanceled.String() {
+		t.Fatalf("canceled item saved as %q after reload", s.Status)
+	}
+	if _, err := m2.Load(statePath); err == nil {
+		t.Fatal("second Load succeeded")
+	}
+}
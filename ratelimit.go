@@ -0,0 +1,68 @@
+package paralleldownload
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// maxRateBurst 为限速器允许的最大突发字节数。
+const maxRateBurst = 1 << 20
+
+// newRateLimiter 创建每秒 bytesPerSecond 字节的限速器，所有 worker 共用以限制总速度。
+// 突发量为 100 毫秒的流量，使速度从一开始就平稳。
+func newRateLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := bytesPerSecond / 10
+	if burst < 1 {
+		burst = 1
+	}
+	if burst > maxRateBurst {
+		burst = maxRateBurst
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// rateLimitedReader 在每次读取后按读取的字节数等待限速器。
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// limitReader 按 WithPartRateLimit 限制单个响应体的速度，再按 WithRateLimit 限制所有线程合计的速度。
+func (o *options) limitReader(ctx context.Context, r io.Reader) io.Reader {
+	if o.partRateLimit > 0 {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: newRateLimiter(o.partRateLimit)}
+	}
+	if o.limiter != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: o.limiter}
+	}
+	return r
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.limiter.WaitN(r.ctx, n); werr != nil && err == nil {
+			err = r.waitError(werr)
+		}
+	}
+	return n, err
+}
+
+// waitError 将限速器的错误转换为 ctx 的错误：等待会超过截止时间时限速器提前返回，
+// 此时同样视为超时，使调用者可以用 errors.Is 判断。
+func (r *rateLimitedReader) waitError(err error) error {
+	if ctxErr := r.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if _, ok := r.ctx.Deadline(); ok {
+		return fmt.Errorf("%w: %v", context.DeadlineExceeded, err)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrURLExpired 表示服务器以 403 拒绝了请求，且判断为下载链接已过期。
+var ErrURLExpired = errors.New("download url expired")
+
+// maxURLRefreshes 为单次分片请求最多刷新链接的次数。
+const maxURLRefreshes = 3
+
+func (w *worker) currentURL() string {
+	w.urlMu.Lock()
+	defer w.urlMu.Unlock()
+	return w.Url
+}
+
+// refreshURL 通过 URLProvider 获取新链接。若 stale 已被其他分片刷新过则直接使用新链接。
+func (w *worker) refreshURL(ctx context.Context, stale string) error {
+	w.urlMu.Lock()
+	defer w.urlMu.Unlock()
+	if w.Url != stale {
+		return nil
+	}
+	url, err := w.opts.urlProvider(ctx)
+	if err != nil {
+		return fmt.Errorf("refresh url error: %w", err)
+	}
+	w.opts.logger.Info("download url refreshed", "old", stale, "new", url)
+	w.Url = url
+	return nil
+}
+
+// expiredHints 为对象存储在链接或凭证过期时返回的错误码与信息(已转为小写)，
+// 只匹配过期，SignatureDoesNotMatch 等签名错误仍视为无权限。
+var expiredHints = [][]byte{
+	[]byte("request has expired"),   // S3、OSS、GCS 的预签名 URL 过期
+	[]byte("expiredtoken"),          // S3、GCS 的临时凭证过期
+	[]byte("authenticationexpired"), // Azure
+}
+
+// isURLExpired 根据 403 响应体判断链接是否过期，兼容 S3、OSS 等对象存储的错误信息。
+func isURLExpired(resp *http.Response) bool {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4*1024))
+	body = bytes.ToLower(body)
+	for _, hint := range expiredHints {
+		if bytes.Contains(body, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// expiringServer 提供 data，链接带 token 参数。第一个分片请求之后当前 token 过期，
+// 之后使用旧 token 的请求返回 403 与 body。
+func expiringServer(t *testing.T, data []byte, body string) (url string, refresh func(ctx context.Context) (string, error), refreshes *atomic.Int32) {
+	var mu sync.Mutex
+	token, expired := 1, false
+	refreshes = &atomic.Int32{}
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		valid := r.URL.Query().Get("token") == fmt.Sprint(token) && !expired
+		if valid && r.Method == http.MethodGet && r.Header.Get("Range") != "bytes=0-0" {
+			expired = true
+		}
+		mu.Unlock()
+		if !valid {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, body)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	refresh = func(ctx context.Context) (string, error) {
+		refreshes.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		token++
+		expired = false
+		return fmt.Sprintf("%s/f.bin?token=%d", s.URL, token), nil
+	}
+	return s.URL + "/f.bin?token=1", refresh, refreshes
+}
+
+func TestURLRefreshOnExpiry(t *testing.T) {
+	data := testContent(40000)
+	url, refresh, refreshes := expiringServer(t, data,
+		`<Error><Code>AccessDenied</Code><Message>Request has expired</Message></Error>`)
+
+	dir := t.TempDir()
+	err := ParallelDownload(url, dir, "f.bin", 4, WithConcurrency(1), WithURLProvider(refresh))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(dir, "f.bin"), data)
+	if n := refreshes.Load(); n != 3 {
+		t.Fatalf("url refreshed %d times, want 3", n)
+	}
+}
+
+func TestURLRefreshPermissionDenied(t *testing.T) {
+	data := testContent(40000)
+	url, refresh, refreshes := expiringServer(t, data,
+		`<Error><Code>SignatureDoesNotMatch</Code><Message>The request signature we calculated does not match the signature you provided.</Message></Error>`)
+
+	err := ParallelDownload(url, t.TempDir(), "f.bin", 4, WithConcurrency(1), WithURLProvider(refresh),
+		WithFallbackPolicy(FallbackNever))
+	var se *StatusError
+	if !errors.As(err, &se) || se.Code != http.StatusForbidden {
+		t.Fatalf("err = %v, want 403 StatusError", err)
+	}
+	if errors.Is(err, ErrURLExpired) {
+		t.Fatalf("permission denial reported as expiry: %v", err)
+	}
+	if n := refreshes.Load(); n != 0 {
+		t.Fatalf("url refreshed %d times on a signature mismatch", n)
+	}
+}
@@ -0,0 +1,139 @@
+package paralleldownload
+
+import (
+	"sync"
+	"time"
+)
+
+// speedSampleInterval 为计算峰值速度时的采样间隔。
+const speedSampleInterval = time.Second
+
+// Report 汇总一次下载的全部统计，由 WithCompletionReport 在下载结束时(包括失败)传给回调。
+type Report struct {
+	URL      string
+	Start    time.Time
+	Duration time.Duration
+	// Bytes 为写入的字节数
+	Bytes int64
+	// AvgSpeed 与 PeakSpeed 单位为字节每秒，PeakSpeed 为每秒采样中的最大值，下载不足一秒时等于 AvgSpeed
+	AvgSpeed    float64
+	PeakSpeed   float64
+	Retries     int64
+	Connections int64
+	// Parts 为多线程下载各分片的情况，单线程下载时为空
+	Parts []PartReport
+	// Err 为下载失败的原因，成功时为 nil
+	Err error
+}
+
+// PartReport 为一个分片的下载情况。
+type PartReport struct {
+	Part     int64
+	Start    int64
+	End      int64
+	Bytes    int64
+	Began    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// reportCollector 收集生成 Report 所需、下载结果中没有的数据。
+type reportCollector struct {
+	start time.Time
+	mu    sync.Mutex
+	peak  float64
+	parts []PartReport
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// startReport 开始统计，未设置 WithCompletionReport 时不做任何事。
+func (o *options) startReport() {
+	if o.reportFunc == nil {
+		return
+	}
+	r := &reportCollector{start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+	o.report = r
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(speedSampleInterval)
+		defer ticker.Stop()
+		last := o.stats.written.Load()
+		for {
+			select {
+			case <-ticker.C:
+				cur := o.stats.written.Load()
+				r.mu.Lock()
+				if speed := float64(cur-last) / speedSampleInterval.Seconds(); speed > r.peak {
+					r.peak = speed
+				}
+				r.mu.Unlock()
+				last = cur
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *reportCollector) addPart(p part, began time.Time, written int64, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parts = append(r.parts, PartReport{
+		Part:     p.num,
+		Start:    p.start,
+		End:      p.end,
+		Bytes:    written,
+		Began:    began,
+		Duration: time.Since(began),
+		Err:      err,
+	})
+}
+
+// finish 生成下载结果，设置了 WithCompletionReport 时同时生成 Report 并调用回调。
+func (o *options) finish(download_url string, err error) *DownloadResult {
+	if err == nil && o.version != nil {
+		o.recordVersion(o.savedPath, o.version)
+	}
+	o.meter.close()
+	if o.clone != nil {
+		o.clone.CloseIdleConnections()
+	}
+	res := o.result()
+	o.emitter.close(download_url, res, err)
+	args := []any{"url", download_url, "path", res.Path, "size", res.Size, "elapsed", res.Elapsed,
+		"speed", res.Speed(), "parallel", res.Parallel, "resumed", res.Resumed, "retries", res.Retries}
+	if err != nil {
+		o.logger.Warn("download failed", append(args, "err", err)...)
+	} else {
+		o.logger.Info("download finished", args...)
+	}
+	r := o.report
+	if r == nil {
+		return res
+	}
+	close(r.stop)
+	<-r.done
+	rep := Report{
+		URL:         download_url,
+		Start:       r.start,
+		Duration:    time.Since(r.start),
+		Bytes:       res.Size,
+		Retries:     o.stats.retries.Load(),
+		Connections: res.ConnectionsOpened,
+		Parts:       r.parts,
+		Err:         err,
+	}
+	if secs := rep.Duration.Seconds(); secs > 0 {
+		rep.AvgSpeed = float64(rep.Bytes) / secs
+	}
+	rep.PeakSpeed = r.peak
+	if rep.PeakSpeed < rep.AvgSpeed {
+		rep.PeakSpeed = rep.AvgSpeed
+	}
+	o.reportFunc(rep)
+	return res
+}
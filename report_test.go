@@ -0,0 +1,68 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func TestCompletionReport(t *testing.T) {
+	data := testContent(4000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad.bin" && r.Header.Get("Range") == "bytes=2000-2999" {
+			http.Error(w, "boom", http.StatusNotFound)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+
+	var reports []Report
+	collect := WithCompletionReport(func(r Report) { reports = append(reports, r) })
+	if err := ParallelDownload(s.URL+"/f.bin", t.TempDir(), "", 4, collect); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("report called %d times", len(reports))
+	}
+	rep := reports[0]
+	if rep.Err != nil || rep.URL != s.URL+"/f.bin" || rep.Bytes != int64(len(data)) || rep.Start.IsZero() ||
+		rep.Duration <= 0 || rep.AvgSpeed <= 0 || rep.PeakSpeed < rep.AvgSpeed || rep.Connections == 0 {
+		t.Fatalf("report = %+v", rep)
+	}
+	if len(rep.Parts) != 4 {
+		t.Fatalf("%d part reports, want 4", len(rep.Parts))
+	}
+	sort.Slice(rep.Parts, func(i, j int) bool { return rep.Parts[i].Part < rep.Parts[j].Part })
+	for i, p := range rep.Parts {
+		start := int64(i) * 1000
+		if p.Part != int64(i) || p.Start != start || p.End != start+999 || p.Bytes != 1000 || p.Began.IsZero() || p.Err != nil {
+			t.Errorf("part report %d = %+v", i, p)
+		}
+	}
+
+	// 失败时同样生成报告，包含出错的分片
+	reports = nil
+	err := ParallelDownload(s.URL+"/bad.bin", t.TempDir(), "", 4, collect)
+	if err == nil {
+		t.Fatal("download succeeded although a part failed")
+	}
+	if len(reports) != 1 {
+		t.Fatalf("report called %d times", len(reports))
+	}
+	rep = reports[0]
+	if rep.Err == nil || rep.Err.Error() != err.Error() || rep.Duration <= 0 {
+		t.Fatalf("report = %+v, err = %v", rep, err)
+	}
+	var failed []PartReport
+	for _, p := range rep.Parts {
+		// 其他分片可能在出错后被取消
+		if p.Err != nil && !errors.Is(p.Err, context.Canceled) {
+			failed = append(failed, p)
+		}
+	}
+	if len(failed) != 1 || failed[0].Part != 2 || failed[0].Bytes != 0 {
+		t.Fatalf("failed part reports = %+v", failed)
+	}
+}
@@ -0,0 +1,85 @@
+package paralleldownload
+
+import (
+	"net/http/httptrace"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// DownloadResult 为一次下载的统计结果。
+type DownloadResult struct {
+	// Size 为写入的字节数，压缩传输时为解码后的大小。
+	Size int64
+	// ConnectionsOpened 为实际新建的连接数，复用的 keep-alive 连接不计入。
+	ConnectionsOpened int64
+	// UpToDate 为 true 表示 DownloadIfNewer 或 ExistUpdate 判断本地文件已是最新，没有下载。
+	UpToDate bool
+	// Skipped 为 true 表示保存路径已经存在文件且设置了 ExistSkip(或 ExistUpdate 判断已是最新)，没有下载。
+	Skipped bool
+	// Path 为保存文件的绝对路径，下载到 io.WriterAt 等目标时为空。
+	Path string
+	// FinalURL 为跟随重定向后实际下载的地址。
+	FinalURL string
+	// Elapsed 为下载(包括获取文件信息)的耗时。
+	Elapsed time.Duration
+	// Parallel 表示是否使用了多线程下载，回退到单线程下载时为 false。
+	Parallel bool
+	// FallbackReason 为回退到单线程下载的原因(如服务器不支持 Range)，没有回退时为 nil，参见 WithFallbackPolicy。
+	FallbackReason error
+	// Resumed 表示是否通过 WithResume 从上次的进度继续下载。
+	Resumed bool
+	// Retries 为分片重试、刷新链接、更换镜像等导致的重试次数。
+	Retries int64
+}
+
+// Speed 返回平均下载速度(字节/秒)，耗时为 0 时返回 0。
+func (r *DownloadResult) Speed() float64 {
+	if r == nil || r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Size) / r.Elapsed.Seconds()
+}
+
+// downloadStats 记录下载过程中的统计数据，各 worker 并发更新。
+type downloadStats struct {
+	connsOpened atomic.Int64
+	written     atomic.Int64
+	// retries 为刷新链接、遵循 Retry-After、CancelPart 等导致的重试次数
+	retries atomic.Int64
+}
+
+// clientTrace 返回用于统计连接的 httptrace 钩子。
+func (s *downloadStats) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				s.connsOpened.Add(1)
+			}
+		},
+	}
+}
+
+func (o *options) result() *DownloadResult {
+	res := &DownloadResult{
+		Size:              o.stats.written.Load(),
+		ConnectionsOpened: o.stats.connsOpened.Load(),
+		Path:              o.savedPath,
+		FinalURL:          o.finalURL,
+		Parallel:          o.parallel,
+		FallbackReason:    o.downgrade,
+		Skipped:           o.skipped,
+		UpToDate:          o.upToDate,
+		Resumed:           o.checkpoint != nil && o.checkpoint.resumed,
+		Retries:           o.stats.retries.Load(),
+	}
+	if !o.started.IsZero() {
+		res.Elapsed = time.Since(o.started)
+	}
+	if res.Path != "" {
+		if abs, err := filepath.Abs(res.Path); err == nil {
+			res.Path = abs
+		}
+	}
+	return res
+}
@@ -0,0 +1,37 @@
+package paralleldownload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConnectionsOpened(t *testing.T) {
+	data := testContent(40000)
+	s := newServer(t, serveData(data))
+	// 顺序下载各分片时一直复用同一个 keep-alive 连接
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ConnectionsOpened != 1 {
+		t.Fatalf("keep-alive: ConnectionsOpened = %d, want 1", res.ConnectionsOpened)
+	}
+
+	var requests atomic.Int64
+	closing := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		serveData(data)(w, r)
+	}))
+	closing.Config.SetKeepAlivesEnabled(false)
+	closing.Start()
+	t.Cleanup(closing.Close)
+	res, err = ParallelDownloadEx(closing.URL+"/f.bin", t.TempDir(), "", 4, WithConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ConnectionsOpened != requests.Load() {
+		t.Fatalf("no keep-alive: ConnectionsOpened = %d, want one per request (%d)", res.ConnectionsOpened, requests.Load())
+	}
+}
@@ -0,0 +1,306 @@
+package paralleldownload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeoutResumable 表示下载因 WithTimeout 超时而中止，但进度已保存，
+// 使用相同参数与 WithResume 再次调用即可继续下载。
+var ErrTimeoutResumable = errors.New("download timed out, progress saved")
+
+// ResumeDownload 与开启 WithResume 的 ParallelDownloadEx 相同：中断(失败、取消或超时)后
+// 以相同参数再次调用时，只下载 <文件名>.pdpart 中记录的缺失范围。
+func ResumeDownload(download_url string, savePath string, filename string, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return ParallelDownloadEx(download_url, savePath, filename, worker_count, append(opts[:len(opts):len(opts)], WithResume())...)
+}
+
+// manifestSuffix 为保存下载进度的文件的后缀。
+const manifestSuffix = ".pdpart"
+
+// partSuffix 为开启续传时下载中的数据文件的后缀，下载完成后重命名为目标文件名。
+const partSuffix = ".part"
+
+// checkpointInterval 为定期保存进度的间隔。
+const checkpointInterval = time.Second
+
+// manifest 为保存在 <文件名>.pdpart 中的下载进度。
+type manifest struct {
+	URL          string         `json:"url"`
+	Size         int64          `json:"size"`
+	ETag         string         `json:"etag,omitempty"`
+	LastModified string         `json:"last_modified,omitempty"`
+	Parts        []manifestPart `json:"parts"`
+}
+
+type manifestPart struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// Written 为从 Start 开始已连续写入的字节数
+	Written int64 `json:"written"`
+}
+
+// checkpoint 记录各分片已写入的字节数，并定期写入 manifest 文件。
+type checkpoint struct {
+	path    string
+	fs      FS
+	file    File
+	m       manifest
+	written []atomic.Int64
+	resumed bool
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newCheckpoint 读取 filePath 对应的进度文件，与当前的 url、大小、ETag 等一致且数据文件 dataPath 完好时从中恢复，
+// 否则按 parts 重新开始。
+func newCheckpoint(filePath string, dataPath string, url string, size int64, header http.Header, parts []part, o *options) *checkpoint {
+	c := &checkpoint{
+		path: filePath + manifestSuffix,
+		fs:   o.fsys(),
+		m: manifest{
+			URL:          url,
+			Size:         size,
+			ETag:         header.Get("ETag"),
+			LastModified: header.Get("Last-Modified"),
+		},
+	}
+	if old, err := readManifest(c.fs, c.path); err == nil {
+		if o.shrinkPolicy == ShrinkTruncate && old.shrunkTo(c.m) {
+			if err := truncateData(c.fs, dataPath, size); err != nil {
+				o.logger.Warn("truncate local data failed", "path", dataPath, "err", err)
+			} else {
+				o.logger.Info("remote file shrank, keep data before new size", "path", dataPath, "old_size", old.Size, "size", size)
+				old.clip(size)
+			}
+		}
+		if reason := old.mismatch(c.m, c.fs, dataPath); reason == "" {
+			c.m.Parts = old.Parts
+			c.resumed = true
+		} else {
+			o.logger.Info("discard download progress", "path", c.path, "reason", reason)
+		}
+	}
+	if !c.resumed {
+		for _, p := range parts {
+			c.m.Parts = append(c.m.Parts, manifestPart{Start: p.start, End: p.end})
+		}
+	}
+	c.written = make([]atomic.Int64, len(c.m.Parts))
+	for i, p := range c.m.Parts {
+		c.written[i].Store(p.Written)
+	}
+	return c
+}
+
+func readManifest(fsys FS, path string) (*manifest, error) {
+	data, err := readFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// shrunkTo 判断远程文件是否只是变小了：url 与 ETag、Last-Modified 均未变化(通常是服务器不提供这些校验值)。
+// ETag 或 Last-Modified 变化说明内容已经改变，不能保留旧数据。
+func (m *manifest) shrunkTo(cur manifest) bool {
+	return m.URL == cur.URL && m.Size > cur.Size && m.ETag == cur.ETag && m.LastModified == cur.LastModified
+}
+
+// clip 丢弃 size 之后的进度，使其对应大小为 size 的文件。
+func (m *manifest) clip(size int64) {
+	var parts []manifestPart
+	for _, p := range m.Parts {
+		if p.Start >= size {
+			break
+		}
+		if p.End >= size {
+			p.End = size - 1
+		}
+		if p.Written > p.End-p.Start+1 {
+			p.Written = p.End - p.Start + 1
+		}
+		parts = append(parts, p)
+	}
+	m.Parts = parts
+	m.Size = size
+}
+
+// truncateData 将大于 size 的本地数据文件截断为 size。
+func truncateData(fsys FS, filePath string, size int64) error {
+	info, err := fsys.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() <= size {
+		return nil
+	}
+	f, err := fsys.OpenFile(filePath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// mismatch 检查保存的进度能否用于当前下载，不能时返回原因。
+func (m *manifest) mismatch(cur manifest, fsys FS, dataPath string) string {
+	switch {
+	case m.URL != cur.URL:
+		return "url changed"
+	case m.Size != cur.Size:
+		return fmt.Sprintf("size changed from %d to %d", m.Size, cur.Size)
+	case m.ETag != cur.ETag:
+		return "etag changed"
+	case m.LastModified != cur.LastModified:
+		return "last-modified changed"
+	}
+	var next int64
+	for _, p := range m.Parts {
+		if p.Start != next || p.End < p.Start || p.Written < 0 || p.Written > p.End-p.Start+1 {
+			return "invalid parts"
+		}
+		next = p.End + 1
+	}
+	if next != m.Size {
+		return "invalid parts"
+	}
+	if info, err := fsys.Stat(dataPath); err != nil || info.Size() > m.Size {
+		return "data file missing or too large"
+	}
+	return ""
+}
+
+// pending 返回尚未完成的分片，起始位置为已写入部分之后。
+func (c *checkpoint) pending() []part {
+	var parts []part
+	for i, p := range c.m.Parts {
+		if written := c.written[i].Load(); p.Start+written <= p.End {
+			parts = append(parts, part{num: int64(i), start: p.Start + written, end: p.End})
+		}
+	}
+	return parts
+}
+
+func (c *checkpoint) add(num int64, n int64) {
+	if c == nil {
+		return
+	}
+	c.written[num].Add(n)
+}
+
+// start 定期将进度写入文件，file 为正在写入的数据文件。
+func (c *checkpoint) start(file File) {
+	c.file = file
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				_ = c.flush()
+			}
+		}
+	}()
+}
+
+// finish 停止定期保存，成功时删除进度文件，失败时保存最终进度。
+func (c *checkpoint) finish(success bool) error {
+	close(c.stop)
+	<-c.done
+	if success {
+		err := c.fs.Remove(c.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return c.flush()
+}
+
+// flush 先同步数据文件再写入进度，保证记录的进度不超过实际写入磁盘的数据。
+func (c *checkpoint) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.m
+	m.Parts = make([]manifestPart, len(c.m.Parts))
+	for i, p := range c.m.Parts {
+		p.Written = c.written[i].Load()
+		m.Parts[i] = p
+	}
+	if err := c.file.Sync(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.fs, c.path, data)
+}
+
+// timedOut 判断 err 是否由 ctx 的截止时间导致。限速器预计等待会超过截止时间时提前返回，
+// 此时 ctx 尚未结束，但错误同样满足 errors.Is(err, context.DeadlineExceeded)。
+func timedOut(ctx context.Context, err error) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+	_, ok := ctx.Deadline()
+	return ok && errors.Is(err, context.DeadlineExceeded)
+}
+
+// resumableError 表示可以继续的超时，同时满足 errors.Is(err, ErrTimeoutResumable)
+// 与 errors.Is(err, context.DeadlineExceeded)。
+type resumableError struct {
+	err error
+}
+
+func (e *resumableError) Error() string {
+	return ErrTimeoutResumable.Error() + ": " + e.err.Error()
+}
+
+func (e *resumableError) Is(target error) bool { return target == ErrTimeoutResumable }
+
+func (e *resumableError) Unwrap() error { return e.err }
+
+// ShrinkPolicy 决定续传时远程文件比上次小的处理方式。
+type ShrinkPolicy int
+
+const (
+	// ShrinkRestart 丢弃进度，清空本地文件重新下载(默认)。
+	ShrinkRestart ShrinkPolicy = iota
+	// ShrinkTruncate 在 ETag、Last-Modified 均未变化时将本地文件截断为新的大小，保留其中已下载的部分，
+	// 适用于只会从末尾截短的文件。校验值变化时仍重新下载。
+	ShrinkTruncate
+)
+
+func (p ShrinkPolicy) String() string {
+	switch p {
+	case ShrinkRestart:
+		return "restart"
+	case ShrinkTruncate:
+		return "truncate"
+	}
+	return fmt.Sprintf("ShrinkPolicy(%d)", int(p))
+}
@@ -0,0 +1,113 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingReader 统计服务器发送的字节数。
+type countingReader struct {
+	throttledReader
+	n *atomic.Int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.throttledReader.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+func TestTimeoutResumable(t *testing.T) {
+	data := testContent(1 << 20)
+	var served atomic.Int64
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 每个连接约 1 MB/s，超时前下载不完
+		http.ServeContent(w, r, "", time.Time{}, countingReader{throttledReader{bytes.NewReader(data), 1 << 10}, &served})
+	}))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f.bin")
+
+	_, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, WithResume(), WithTimeout(150*time.Millisecond))
+	if !errors.Is(err, ErrTimeoutResumable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrTimeoutResumable", err)
+	}
+	if _, err := os.Stat(path + manifestSuffix); err != nil {
+		t.Fatalf("progress not saved: %v", err)
+	}
+	first := served.Load()
+	if first == 0 || first >= int64(len(data)) {
+		t.Fatalf("first attempt served %d bytes", first)
+	}
+
+	served.Store(0)
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, WithResume())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resumed {
+		t.Fatal("second attempt did not resume")
+	}
+	checkFile(t, path, data)
+	// 已保存的部分不会重新下载
+	if second := served.Load(); second > int64(len(data))-first/2 {
+		t.Fatalf("second attempt served %d bytes after %d were saved", second, first)
+	}
+	for _, suffix := range []string{manifestSuffix, partSuffix} {
+		if _, err := os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s left behind: %v", suffix, err)
+		}
+	}
+
+	// 没有开启续传时超时返回普通的 DeadlineExceeded
+	_, err = ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 4, WithTimeout(50*time.Millisecond))
+	if errors.Is(err, ErrTimeoutResumable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("without resume: err = %v", err)
+	}
+}
+
+func TestShrinkOnResume(t *testing.T) {
+	full := testContent(1 << 20)
+	for _, policy := range []ShrinkPolicy{ShrinkRestart, ShrinkTruncate} {
+		var current atomic.Value
+		current.Store(full)
+		var throttled atomic.Bool
+		throttled.Store(true)
+		s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			data := current.Load().([]byte)
+			if throttled.Load() {
+				http.ServeContent(w, r, "", time.Time{}, throttledReader{bytes.NewReader(data), 1 << 10})
+				return
+			}
+			serveData(data)(w, r)
+		}))
+		dir := t.TempDir()
+		path := filepath.Join(dir, "f.bin")
+		if _, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, WithResume(), WithTimeout(150*time.Millisecond)); !errors.Is(err, ErrTimeoutResumable) {
+			t.Fatalf("%v: first attempt err = %v", policy, err)
+		}
+
+		// 两次下载之间远程文件从末尾截短了，服务器不提供 ETag 与 Last-Modified
+		small := full[:600000]
+		current.Store(small)
+		throttled.Store(false)
+		res, err := ParallelDownloadEx(s.URL+"/f.bin", dir, "", 4, WithResume(), WithShrinkPolicy(policy))
+		if err != nil {
+			t.Fatalf("%v: %v", policy, err)
+		}
+		checkFile(t, path, small)
+		if res.Resumed != (policy == ShrinkTruncate) {
+			t.Fatalf("%v: resumed = %v", policy, res.Resumed)
+		}
+		// 截断时保留已下载的部分，重新开始时下载整个文件
+		if full := res.Size == int64(len(small)); full != (policy == ShrinkRestart) {
+			t.Fatalf("%v: wrote %d of %d bytes", policy, res.Size, len(small))
+		}
+	}
+}
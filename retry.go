@@ -0,0 +1,103 @@
+package paralleldownload
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRetryBackoff 为重试前等待时间的上限。
+const maxRetryBackoff = 30 * time.Second
+
+// StatusError 表示服务器以错误状态码(>= 400)响应了请求，可用 errors.As 取得状态码。
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status: %s", e.Status)
+}
+
+// isTransient 判断分片下载的错误是否可能在重试后消失：连接被拒绝或中断(包括 HTTP/2 连接断开)、超时、
+// 响应体不完整、分片卡住以及 5xx、408、429。
+// 404、416 等其他状态码、域名不存在等其他网络错误、TLS 证书错误、被拒绝的重定向及数据校验类错误不重试。
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isTLSError(err) || errors.Is(err, ErrCrossHostRedirect) || errors.Is(err, ErrTooManyRedirects) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500 || se.Code == http.StatusRequestTimeout || se.Code == http.StatusTooManyRequests
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrSizeMismatch) || errors.Is(err, ErrPartStalled) || isConnError(err) {
+		return true
+	}
+	if isHTTP2ConnLost(err) {
+		return true
+	}
+	// http.Client 返回的错误都是 *url.Error，它本身也实现了 net.Error，需要看其中的原因
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		if errors.Is(ue.Err, io.EOF) {
+			// 服务器在响应前关闭了连接
+			return true
+		}
+		err = ue.Err
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// isTLSError 判断是否为证书校验失败、握手失败等 TLS 错误，重试不会改变结果。
+func isTLSError(err error) bool {
+	var unknown x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var record tls.RecordHeaderError
+	if errors.As(err, &unknown) || errors.As(err, &invalid) || errors.As(err, &hostname) || errors.As(err, &record) {
+		return true
+	}
+	// 握手时收到的 alert 没有导出的类型
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// isHTTP2ConnLost 判断是否为 HTTP/2 连接中断(连接断开或服务器发送 GOAWAY 后关闭)，
+// 这些错误的类型没有导出，只能按错误信息判断。
+func isHTTP2ConnLost(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "http2: client connection lost") ||
+		strings.Contains(msg, "http2: server sent GOAWAY and closed the connection")
+}
+
+// retryBackoff 返回第 attempt 次失败后的等待时间：base 按指数增长，取其一半到全部之间的随机值，
+// 避免各线程同时重试。
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package paralleldownload
+
+// isConnError 在没有 errno 的系统(如 plan9)上总是返回 false，只按超时判断是否重试。
+func isConnError(err error) bool {
+	return false
+}
@@ -0,0 +1,80 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// clientErr 返回用 client 请求 u 得到的错误。
+func clientErr(t *testing.T, client *http.Client, u string) error {
+	t.Helper()
+	resp, err := client.Get(u)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("GET %s succeeded", u)
+	}
+	return err
+}
+
+func TestIsTransient(t *testing.T) {
+	// 证书不受信任的服务器
+	untrusted := httptest.NewUnstartedServer(http.NotFoundHandler())
+	untrusted.Config.ErrorLog = log.New(io.Discard, "", 0)
+	untrusted.StartTLS()
+	defer untrusted.Close()
+	// 已关闭的服务器，连接被拒绝
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	redirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return fmt.Errorf("%w: a -> b", ErrCrossHostRedirect)
+	}}
+	redirecting := newServer(t, http.RedirectHandler("/elsewhere", http.StatusFound))
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"untrusted certificate", clientErr(t, http.DefaultClient, untrusted.URL), false},
+		{"connection refused", clientErr(t, http.DefaultClient, closed.URL), true},
+		{"i/o timeout", &url.Error{Op: "Get", URL: "http://a", Err: os.ErrDeadlineExceeded}, true},
+		{"cross-host redirect", clientErr(t, redirect, redirecting.URL), false},
+		{"too many redirects", &url.Error{Op: "Get", URL: "http://a", Err: ErrTooManyRedirects}, false},
+		{"other url error", &url.Error{Op: "Get", URL: "http://a", Err: errors.New("unsupported protocol scheme")}, false},
+		{"closed before response", &url.Error{Op: "Get", URL: "http://a", Err: io.EOF}, true},
+		{"no such host", &url.Error{Op: "Get", URL: "http://a", Err: &net.OpError{Op: "dial", Net: "tcp",
+			Err: &net.DNSError{Err: "no such host", Name: "nonexistent.invalid", IsNotFound: true}}}, false},
+		{"dns timeout", &url.Error{Op: "Get", URL: "http://a", Err: &net.OpError{Op: "dial", Net: "tcp",
+			Err: &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}}}, true},
+		{"permission denied", &url.Error{Op: "Get", URL: "http://a", Err: &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrPermission}}, false},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"stalled", ErrPartStalled, true},
+		{"503", &StatusError{Code: 503, Status: "503 Service Unavailable"}, true},
+		{"429", &StatusError{Code: 429, Status: "429 Too Many Requests"}, true},
+		{"404", &StatusError{Code: 404, Status: "404 Not Found"}, false},
+		{"canceled", &url.Error{Op: "Get", URL: "http://a", Err: context.Canceled}, false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("%s: isTransient(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+
+	// 证书错误不重试，但换一个镜像可能成功
+	if err := clientErr(t, http.DefaultClient, untrusted.URL); !mirrorFault(err) {
+		t.Errorf("mirrorFault(%v) = false", err)
+	}
+	if err := errors.New("write: no space left on device"); mirrorFault(err) {
+		t.Errorf("mirrorFault(%v) = true", err)
+	}
+}
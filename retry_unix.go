@@ -0,0 +1,13 @@
+//go:build unix
+
+package paralleldownload
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnError 判断是否为连接被拒绝、被重置或写入已关闭的连接。
+func isConnError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,15 @@
+package paralleldownload
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeconnrefused 为 Windows 的 WSAECONNREFUSED，syscall 中没有定义。
+const wsaeconnrefused syscall.Errno = 10061
+
+// isConnError 判断是否为连接被拒绝、被重置或被中止。
+func isConnError(err error) bool {
+	return errors.Is(err, wsaeconnrefused) || errors.Is(err, syscall.WSAECONNRESET) || errors.Is(err, syscall.WSAECONNABORTED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,96 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRetryAfterTooLong 表示服务器要求的 Retry-After 超过了 WithMaxRetryAfter 的上限，且设置为超过即失败。
+var ErrRetryAfterTooLong = errors.New("retry-after exceeds limit")
+
+// defaultMaxRetryAfter 为未设置 WithMaxRetryAfter 时最多遵循的 Retry-After 等待时间。
+const defaultMaxRetryAfter = 5 * time.Minute
+
+// maxRetryAfterRetries 为单次分片请求因 Retry-After 最多重试的次数。
+const maxRetryAfterRetries = 5
+
+// retryAfterError 表示服务器以 429 或 503 拒绝了请求，并通过 Retry-After 指定了等待时间。
+type retryAfterError struct {
+	code   int
+	status string
+	after  time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("bad status: %s, retry after %s", e.status, e.after)
+}
+
+// Unwrap 使调用者仍可用 errors.As 取得 StatusError。
+func (e *retryAfterError) Unwrap() error {
+	return &StatusError{Code: e.code, Status: e.status}
+}
+
+// retryAfter 从 429、503 响应中解析 Retry-After，其他响应或无法解析时返回 nil。
+func retryAfter(resp *http.Response) *retryAfterError {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil
+	}
+	after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		return nil
+	}
+	return &retryAfterError{code: resp.StatusCode, status: resp.Status, after: after}
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期格式的 Retry-After，已经过去的日期视为 0。
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		if seconds > int64(1<<63-1)/int64(time.Second) {
+			return time.Duration(1<<63 - 1), true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// retryAfterWait 返回实际等待的时间：超过上限时等待上限，或在设置了超过即失败时返回 ErrRetryAfterTooLong。
+func (o *options) retryAfterWait(after time.Duration) (time.Duration, error) {
+	if after <= o.maxRetryAfter {
+		return after, nil
+	}
+	if o.retryAfterFail {
+		return 0, fmt.Errorf("%w: server asked to wait %s, limit is %s", ErrRetryAfterTooLong, after, o.maxRetryAfter)
+	}
+	return o.maxRetryAfter, nil
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回 ctx.Err()。
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,100 @@
+package paralleldownload
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryAfterServer 对分片 bytes=5000-9999 的第一次请求返回 503 与 Retry-After: after。
+func retryAfterServer(t *testing.T, data []byte, after string) (url string, rejected *atomic.Int32) {
+	rejected = &atomic.Int32{}
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=5000-9999" && rejected.Add(1) == 1 {
+			w.Header().Set("Retry-After", after)
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	return s.URL + "/f.bin", rejected
+}
+
+func TestMaxRetryAfterCap(t *testing.T) {
+	data := testContent(10000)
+	url, rejected := retryAfterServer(t, data, "86400")
+	start := time.Now()
+	res, err := ParallelDownloadEx(url, t.TempDir(), "", 2, WithMaxRetryAfter(100*time.Millisecond, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 5*time.Second {
+		t.Fatalf("download took %v, want about the 100ms cap", elapsed)
+	}
+	if rejected.Load() != 2 || res.Retries != 1 {
+		t.Fatalf("part requested %d times, %d retries", rejected.Load(), res.Retries)
+	}
+}
+
+func TestMaxRetryAfterFail(t *testing.T) {
+	data := testContent(10000)
+	url, _ := retryAfterServer(t, data, "86400")
+	start := time.Now()
+	_, err := ParallelDownloadEx(url, t.TempDir(), "", 2, WithMaxRetryAfter(time.Second, true), WithFallbackPolicy(FallbackNever))
+	if !errors.Is(err, ErrRetryAfterTooLong) {
+		t.Fatalf("err = %v, want ErrRetryAfterTooLong", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("failed after %v instead of immediately", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+		ok   bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 0 ", 0, true},
+		{"99999999999999999", time.Duration(1<<63 - 1), true},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 31 Dec 2023 00:00:00 GMT", 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.v, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryAfterLongerThanStallTimeout(t *testing.T) {
+	data := testContent(10000)
+	// 服务器要求等 45 秒，测试中按上限等待 400ms，仍远长于 100ms 的卡住判断时间
+	url, rejected := retryAfterServer(t, data, "45")
+	logger := &recordLogger{}
+	start := time.Now()
+	res, err := ParallelDownloadEx(url, t.TempDir(), "", 2, WithMaxRetryAfter(400*time.Millisecond, false),
+		WithStallTimeout(100*time.Millisecond), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("download took %v, shorter than the Retry-After wait", elapsed)
+	}
+	if _, ok := logger.find("part stalled, restarting"); ok {
+		t.Fatal("Retry-After wait counted as a stall")
+	}
+	if rejected.Load() != 2 || res.Retries != 1 {
+		t.Fatalf("part requested %d times, %d retries", rejected.Load(), res.Retries)
+	}
+}
@@ -0,0 +1,183 @@
+// Package sftp 为 paralleldownload 提供 SFTP 协议，SSH 相关的依赖只在导入本包时引入。
+//
+//	p := sftp.New(&ssh.ClientConfig{
+//		User:            "user",
+//		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//		HostKeyCallback: knownHosts,
+//	})
+//	res, err := pd.Get("sftp://example.com/data/file.bin", pd.WithProtocol("sftp", p))
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Protocol 通过 SFTP 下载 sftp:// URL，实现 paralleldownload.Protocol。
+// 每次 Stat 与 Open 使用单独的 SSH 连接，多个分片各自占用一个连接并行下载。
+type Protocol struct {
+	config *ssh.ClientConfig
+	dialer net.Dialer
+}
+
+// New 返回使用 config 连接服务器的 Protocol。config 必须设置 HostKeyCallback；
+// config.User 为空时使用 URL 中的用户名，URL 带密码时追加密码认证。
+func New(config *ssh.ClientConfig) *Protocol {
+	return &Protocol{config: config}
+}
+
+func (p *Protocol) Stat(ctx context.Context, u *url.URL) (int64, bool, error) {
+	c, err := p.dial(ctx, u)
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.Close()
+	stop := c.closeOnDone(ctx)
+	defer stop()
+	fi, err := c.sftp.Stat(u.Path)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, false, ctxErr
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if !fi.Mode().IsRegular() {
+		return 0, false, fmt.Errorf("sftp url %s is not a regular file", u.Redacted())
+	}
+	return fi.Size(), true, nil
+}
+
+func (p *Protocol) Open(ctx context.Context, u *url.URL, offset int64) (io.ReadCloser, int64, error) {
+	c, err := p.dial(ctx, u)
+	if err != nil {
+		return nil, 0, err
+	}
+	stop := c.closeOnDone(ctx)
+	f, err := c.sftp.Open(u.Path)
+	if err != nil {
+		stop()
+		c.Close()
+		return nil, 0, err
+	}
+	fail := func(err error) (io.ReadCloser, int64, error) {
+		stop()
+		f.Close()
+		c.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, 0, ctxErr
+		}
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return fail(err)
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return fail(err)
+		}
+	}
+	return &body{f: f, c: c, stop: stop}, fi.Size(), nil
+}
+
+// conn 为一个 SSH 连接及其上的 SFTP 会话。
+type conn struct {
+	net  net.Conn
+	ssh  *ssh.Client
+	sftp *sftp.Client
+}
+
+func (p *Protocol) dial(ctx context.Context, u *url.URL) (*conn, error) {
+	if p.config == nil {
+		return nil, errors.New("sftp: nil ssh client config")
+	}
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return nil, fmt.Errorf("sftp url %s does not name a file", u.Redacted())
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	config := *p.config
+	if config.User == "" && u.User != nil {
+		config.User = u.User.Username()
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			config.Auth = append(config.Auth[:len(config.Auth):len(config.Auth)], ssh.Password(pass))
+		}
+	}
+	nc, err := p.dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	c := &conn{net: nc}
+	stop := c.closeOnDone(ctx)
+	defer stop()
+	sc, chans, reqs, err := ssh.NewClientConn(nc, addr, &config)
+	if err != nil {
+		nc.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("sftp connect %s: %w", addr, err)
+	}
+	c.ssh = ssh.NewClient(sc, chans, reqs)
+	c.sftp, err = sftp.NewClient(c.ssh)
+	if err != nil {
+		c.ssh.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("sftp session %s: %w", addr, err)
+	}
+	return c, nil
+}
+
+// closeOnDone 在 ctx 结束时关闭连接，返回的函数停止等待。
+func (c *conn) closeOnDone(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.net.Close()
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func (c *conn) Close() error {
+	c.sftp.Close()
+	return c.ssh.Close()
+}
+
+// body 为打开的远程文件，ctx 结束时中断读取，关闭时同时关闭连接。
+type body struct {
+	f    *sftp.File
+	c    *conn
+	stop func()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	return b.f.Read(p)
+}
+
+func (b *body) Close() error {
+	b.stop()
+	b.f.Close()
+	return b.c.Close()
+}
@@ -0,0 +1,155 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	pd "github.com/Doraemonkeys/ParallelDownload"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer 启动只接受密码 secret 的 SFTP 服务器，返回地址、主机公钥及已建立的连接数。
+func testServer(t *testing.T) (addr string, hostKey ssh.PublicKey, conns *atomic.Int32) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	conns = &atomic.Int32{}
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(nc, config, conns)
+		}
+	}()
+	return l.Addr().String(), signer.PublicKey(), conns
+}
+
+func serveConn(nc net.Conn, config *ssh.ServerConfig, conns *atomic.Int32) {
+	defer nc.Close()
+	_, chans, reqs, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		return
+	}
+	conns.Add(1)
+	go ssh.DiscardRequests(reqs)
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range reqs {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					go func() {
+						defer ch.Close()
+						if s, err := sftp.NewServer(ch, sftp.ReadOnly()); err == nil {
+							s.Serve()
+						}
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	src := filepath.Join(t.TempDir(), "src.bin")
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	addr, hostKey, conns := testServer(t)
+	p := New(&ssh.ClientConfig{HostKeyCallback: ssh.FixedHostKey(hostKey)})
+	u := fmt.Sprintf("sftp://user:secret@%s%s", addr, filepath.ToSlash(src))
+
+	dir := t.TempDir()
+	res, err := pd.ParallelDownloadEx(u, dir, "", 4, pd.WithProtocol("sftp", p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(res.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch, got %d bytes, want %d", len(got), len(data))
+	}
+	if filepath.Base(res.Path) != "src.bin" || !res.Parallel {
+		t.Fatalf("path = %s, parallel = %v (%v)", res.Path, res.Parallel, res.FallbackReason)
+	}
+	// 获取信息之外每个分片各用一个连接
+	if n := conns.Load(); n < 5 {
+		t.Fatalf("%d ssh connections, want at least 5", n)
+	}
+
+	// 密码错误与主机密钥不符时失败
+	bad := fmt.Sprintf("sftp://user:wrong@%s%s", addr, filepath.ToSlash(src))
+	if _, err := pd.ParallelDownloadEx(bad, t.TempDir(), "", 4, pd.WithProtocol("sftp", p)); err == nil {
+		t.Fatal("download with a wrong password succeeded")
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewPublicKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict := New(&ssh.ClientConfig{HostKeyCallback: ssh.FixedHostKey(otherKey)})
+	if _, err := pd.ParallelDownloadEx(u, t.TempDir(), "", 4, pd.WithProtocol("sftp", strict)); err == nil {
+		t.Fatal("download from a server with an unknown host key succeeded")
+	}
+}
+
+func TestOpenCanceled(t *testing.T) {
+	addr, hostKey, _ := testServer(t)
+	p := New(&ssh.ClientConfig{User: "user", Auth: []ssh.AuthMethod{ssh.Password("secret")}, HostKeyCallback: ssh.FixedHostKey(hostKey)})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u := &url.URL{Scheme: "sftp", Host: addr, Path: "/etc/hostname"}
+	if _, _, err := p.Open(ctx, u, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,132 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrPartStalled 表示分片在 WithStallTimeout 指定的时间内没有收到任何数据，
+// 或速度低于 WithMinSpeed 的下限。
+var ErrPartStalled = errors.New("part stalled")
+
+// defaultStallTimeout 为默认判断分片卡住的时间。
+const defaultStallTimeout = 30 * time.Second
+
+// maxStallRestarts 为单个分片因卡住最多重新请求的次数，不计入 WithRetry 的次数。
+const maxStallRestarts = 3
+
+// stallWatch 在等待响应或读取响应体超过 timeout 仍没有数据，或读取速度低于 minSpeed 时取消请求。
+// 暂停与限速的等待不在读取之内，不计入；Retry-After 的等待与刷新链接由 requestRange 暂停计时。
+type stallWatch struct {
+	timeout  time.Duration
+	minSpeed int64
+	window   time.Duration
+	timer    *time.Timer
+	cancel   context.CancelFunc
+
+	mu     sync.Mutex
+	reason string // 取消请求的原因，为空表示没有卡住
+	busy   time.Duration
+	bytes  int64
+}
+
+// watchStall 返回监视分片卡住的 ctx，从现在开始计时。未设置超时与速度下限时返回 nil。
+func (w *worker) watchStall(ctx context.Context) (context.Context, *stallWatch) {
+	o := w.opts
+	if o.stallTimeout <= 0 && o.minSpeed <= 0 {
+		return ctx, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &stallWatch{timeout: o.stallTimeout, minSpeed: o.minSpeed, window: o.minSpeedWindow, cancel: cancel}
+	if s.timeout > 0 {
+		s.timer = time.AfterFunc(s.timeout, func() {
+			s.fire(fmt.Sprintf("no data for %s", s.timeout))
+		})
+	}
+	return ctx, s
+}
+
+func (s *stallWatch) fire(reason string) {
+	s.mu.Lock()
+	if s.reason == "" {
+		s.reason = reason
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+func (s *stallWatch) arm() {
+	if s != nil && s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+}
+
+func (s *stallWatch) disarm() {
+	if s != nil && s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// stalled 返回请求被取消的原因，没有卡住时返回空字符串。
+func (s *stallWatch) stalled() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reason
+}
+
+func (s *stallWatch) stop() {
+	if s != nil {
+		s.disarm()
+		s.cancel()
+	}
+}
+
+// read 记录一次读取，读取累计满一个窗口后检查速度。
+func (s *stallWatch) read(n int, d time.Duration) {
+	if s.minSpeed <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.busy += d
+	s.bytes += int64(n)
+	busy, bytes := s.busy, s.bytes
+	if busy >= s.window {
+		s.busy, s.bytes = 0, 0
+	}
+	s.mu.Unlock()
+	if busy < s.window {
+		return
+	}
+	if speed := int64(float64(bytes) / busy.Seconds()); speed < s.minSpeed {
+		s.fire(fmt.Sprintf("speed %d B/s below %d B/s", speed, s.minSpeed))
+	}
+}
+
+// reader 返回只在读取期间计时的 r。
+func (s *stallWatch) reader(r *rangeBody) io.Reader {
+	if s == nil {
+		return r
+	}
+	return &stallReader{r: r, s: s}
+}
+
+type stallReader struct {
+	r io.Reader
+	s *stallWatch
+}
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	sr.s.arm()
+	start := time.Now()
+	n, err := sr.r.Read(p)
+	sr.s.disarm()
+	sr.s.read(n, time.Since(start))
+	return n, err
+}
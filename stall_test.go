@@ -0,0 +1,54 @@
+package paralleldownload
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStallRestart(t *testing.T) {
+	data := testContent(30000)
+	const partStart, partEnd, half = 20000, 29999, 5000
+	partRange := fmt.Sprintf("bytes=%d-%d", partStart, partEnd)
+	var mu sync.Mutex
+	var ranges []string
+	var hung atomic.Bool
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		mu.Lock()
+		ranges = append(ranges, rng)
+		mu.Unlock()
+		if rng == partRange && hung.CompareAndSwap(false, true) {
+			// 最后一个分片第一次请求时发送一半后不再发送数据
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", partStart, partEnd, len(data)))
+			w.Header().Set("Content-Length", fmt.Sprint(partEnd-partStart+1))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(data[partStart : partStart+half])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+
+	logger := &recordLogger{}
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 3, WithBufferSize(1000),
+		WithStallTimeout(200*time.Millisecond), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if _, ok := logger.find("part stalled, restarting"); !ok {
+		t.Fatal("stall not logged")
+	}
+	// 卡住的分片从已写入的位置重新请求
+	want := fmt.Sprintf("bytes=%d-%d", partStart+half, partEnd)
+	mu.Lock()
+	defer mu.Unlock()
+	if last := ranges[len(ranges)-1]; last != want {
+		t.Fatalf("restarted range = %q, want %q (all: %q)", last, want, ranges)
+	}
+}
@@ -0,0 +1,122 @@
+package paralleldownload
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// stealer 在所有分片都已开始后，把剩余最多的正在下载的分片的后一半分给空闲的线程，
+// 避免最后个别较慢的连接拖慢整个下载。
+type stealer struct {
+	minSize int64
+	// pending 为尚未开始的分片数，为 0 后才拆分
+	pending atomic.Int64
+
+	mu   sync.Mutex
+	next int64 // 拆分出的新分片的编号
+	live map[int64]*liveRange
+}
+
+// liveRange 为正在下载的分片中尚未写入的范围，pos 为下一个要写入的偏移。
+type liveRange struct {
+	pos int64
+	end int64
+}
+
+// newStealer 在设置了 WithWorkStealing 时返回 stealer。续传时分片的范围记录在进度文件中，不拆分。
+func (o *options) newStealer(parts []part) *stealer {
+	if o.stealMinSize <= 0 || o.checkpoint != nil {
+		return nil
+	}
+	s := &stealer{minSize: o.stealMinSize, live: make(map[int64]*liveRange)}
+	s.pending.Store(int64(len(parts)))
+	for _, p := range parts {
+		if p.num >= s.next {
+			s.next = p.num + 1
+		}
+	}
+	return s
+}
+
+// begin 开始跟踪分片 p，拆分出的分片在 steal 中开始跟踪。
+func (s *stealer) begin(p part) {
+	if s == nil {
+		return
+	}
+	s.pending.Add(-1)
+	s.mu.Lock()
+	s.live[p.num] = &liveRange{pos: p.start, end: p.end}
+	s.mu.Unlock()
+}
+
+// finish 结束跟踪分片，返回其最终的结束位置。
+func (s *stealer) finish(p part) part {
+	if s == nil {
+		return p
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lr, ok := s.live[p.num]; ok {
+		p.end = lr.end
+		delete(s.live, p.num)
+	}
+	return p
+}
+
+// endOf 返回分片当前的结束位置，拆分后会变小。
+func (s *stealer) endOf(num int64, end int64) int64 {
+	if s == nil {
+		return end
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lr, ok := s.live[num]; ok {
+		return lr.end
+	}
+	return end
+}
+
+// reserve 在写入 off 处的 n 字节之前调用，返回不超出分片当前结束位置的字节数。
+func (s *stealer) reserve(num int64, off int64, n int) int {
+	if s == nil {
+		return n
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lr, ok := s.live[num]
+	if !ok {
+		return n
+	}
+	if off > lr.end {
+		return 0
+	}
+	if left := lr.end - off + 1; int64(n) > left {
+		n = int(left)
+	}
+	lr.pos = off + int64(n)
+	return n
+}
+
+// steal 拆分剩余最多的分片，返回其后一半作为新分片。还有分片未开始或剩余不足 2*minSize 时返回 false。
+func (s *stealer) steal() (part, bool) {
+	if s == nil || s.pending.Load() > 0 {
+		return part{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var victim *liveRange
+	for _, lr := range s.live {
+		if victim == nil || lr.end-lr.pos > victim.end-victim.pos {
+			victim = lr
+		}
+	}
+	if victim == nil || victim.end-victim.pos+1 < 2*s.minSize {
+		return part{}, false
+	}
+	mid := victim.pos + (victim.end-victim.pos+1)/2
+	p := part{num: s.next, start: mid, end: victim.end}
+	s.next++
+	victim.end = mid - 1
+	s.live[p.num] = &liveRange{pos: p.start, end: p.end}
+	return p, true
+}
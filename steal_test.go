@@ -0,0 +1,70 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWorkStealing(t *testing.T) {
+	data := testContent(64 << 10)
+	const partSize = 16 << 10
+	// 第一个分片很慢，其他分片结束后空闲的线程拆分它
+	slow := byteServer(t, data, func(start int) bool { return start < partSize })
+	var mu sync.Mutex
+	var ranges []string
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			ranges = append(ranges, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		slow.Config.Handler.ServeHTTP(w, r)
+	}))
+
+	dst := &recordingWriterAt{data: make([]byte, len(data))}
+	logger := &recordLogger{}
+	res, err := ParallelDownloadToWriterAt(s.URL+"/f.bin", dst, 4, WithWorkStealing(1<<10), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst.data, data) {
+		t.Fatal("content mismatch")
+	}
+	if res.Size != int64(len(data)) {
+		t.Fatalf("size = %d, want %d", res.Size, len(data))
+	}
+	e, ok := logger.find("split slow part")
+	if !ok {
+		t.Fatal("slow part was not split")
+	}
+	// 拆分出的分片从慢分片中间开始请求
+	stolen := fmt.Sprintf("bytes=%v-", e.attrs["start"])
+	mu.Lock()
+	found := false
+	for _, rng := range ranges {
+		found = found || strings.HasPrefix(rng, stolen)
+	}
+	mu.Unlock()
+	if !found {
+		t.Fatalf("no request for the split range %s (all: %q)", stolen, ranges)
+	}
+
+	// 所有写入首尾相接，既没有空隙也没有重叠
+	writes := append([]Range(nil), dst.writes...)
+	sort.Slice(writes, func(i, j int) bool { return writes[i].Start < writes[j].Start })
+	var next int64
+	for _, w := range writes {
+		if w.Start != next {
+			t.Fatalf("write %+v after offset %d: gap or overlap", w, next)
+		}
+		next = w.End + 1
+	}
+	if next != int64(len(data)) {
+		t.Fatalf("writes end at %d, want %d", next, len(data))
+	}
+}
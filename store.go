@@ -0,0 +1,190 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Range 为文件中的一段字节，Start 与 End 均包含在内。
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// PartStore 保存下载的数据，使下载不局限于本地文件(如对象存储、数据库)。
+// WriteAt 会被多个线程并发调用。
+type PartStore interface {
+	io.WriterAt
+	// Finalize 在所有数据写入完成后调用一次。
+	Finalize() error
+	// CompletedRanges 返回已经保存、无需再下载的范围，下载开始前调用。
+	CompletedRanges() []Range
+}
+
+// ParallelDownloadToStore 多线程下载 url 并写入 store，跳过 store.CompletedRanges 中已有的范围，
+// 全部完成后调用 store.Finalize。服务器不支持 Range 时从头顺序写入。
+func ParallelDownloadToStore(download_url string, store PartStore, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return ParallelDownloadToStoreContext(context.Background(), download_url, store, worker_count, opts...)
+}
+
+// ParallelDownloadToStoreContext 与 ParallelDownloadToStore 相同，ctx 取消时停止下载并返回 ctx.Err()，不调用 store.Finalize。
+func ParallelDownloadToStoreContext(ctx context.Context, download_url string, store PartStore, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	err := canceledError(ctx, parallelTo(dctx, download_url, store, worker_count, o))
+	return o.finish(download_url, err), err
+}
+
+// parallelTo 多线程下载 url 并写入 store，服务器不支持 Range 时从偏移 0 开始顺序写入。
+func parallelTo(ctx context.Context, download_url string, store PartStore, worker_count int64, o *options) error {
+	o.emitter.start(download_url)
+	download_url, file_size, _, resolved, err := o.probe(ctx, download_url)
+	if errors.Is(err, ErrETagMismatch) || ctx.Err() != nil {
+		return err
+	}
+	if err == nil {
+		if err := o.checkSize(file_size); err != nil {
+			return err
+		}
+	}
+	if err == nil && file_size < 0 {
+		err = errSizeUnknown
+	}
+	if err != nil {
+		o.emitter.probe(-1, false, err)
+	} else {
+		o.emitter.probe(file_size, true, nil)
+	}
+	if err != nil {
+		if ferr := o.fallback(err, rangeUnsupported(err)); ferr != nil {
+			return ferr
+		}
+	}
+	if err == nil && file_size > 0 {
+		if worker_count <= 0 {
+			worker_count = o.autoWorkers(file_size)
+		}
+		if s, ok := store.(sizedStore); ok {
+			if err := s.allocate(file_size); err != nil {
+				return err
+			}
+		}
+		parts := pendingParts(file_size, store.CompletedRanges(), o.partCount(file_size, worker_count))
+		err = runParts(ctx, resolved, store, file_size, parts, o)
+		if err == nil {
+			return store.Finalize()
+		}
+		if !(o.assumeRangeSupport && errors.Is(err, ErrRangeNotSupported)) && !(resolved != download_url && resolvedRejected(err)) {
+			return err
+		}
+		if ferr := o.fallback(err, true); ferr != nil {
+			return ferr
+		}
+	}
+	o.logger.Debug("download by single stream", "url", download_url, "reason", err)
+	if err := streamTo(ctx, download_url, &offsetWriter{w: store}, o); err != nil {
+		return err
+	}
+	return store.Finalize()
+}
+
+// streamTo 单线程下载 url 并按顺序写入 w。
+func streamTo(ctx context.Context, download_url string, w io.Writer, o *options) error {
+	o.parallel = false
+	resp, body, err := openStream(ctx, download_url, o)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if o.onData != nil {
+		w = io.MultiWriter(w, &callbackWriter{fn: o.onData})
+	}
+	if o.tee != nil {
+		w = io.MultiWriter(w, &teeWriter{ctx: ctx, t: o.tee})
+	}
+	progress := o.newProgress(o.bodyLength(resp), nil)
+	if progress != nil {
+		w = io.MultiWriter(w, progressWriter{r: progress})
+	}
+	w = io.MultiWriter(w, &statsWriter{s: &o.stats, max: o.maxSize})
+	o.emitter.part(ChunkStarted, streamPart(o.bodyLength(resp)), 0, nil)
+	o.meter.addActive(1)
+	n, err := io.Copy(w, body)
+	o.meter.addActive(-1)
+	progress.finish(err)
+	o.audit.record(download_url, part{num: 0, start: 0, end: n - 1}, n, err)
+	o.emitter.part(ChunkCompleted, part{num: 0, start: 0, end: n - 1}, n, err)
+	return err
+}
+
+// pendingParts 将 [0, file_size) 中未完成的范围分为约 count 个分片，
+// 每段缺失的范围按其长度分得相应数量的分片。
+func pendingParts(file_size int64, completed []Range, count int64) []part {
+	var done []byteRange
+	for _, r := range completed {
+		done = append(done, byteRange{start: r.Start, end: r.End})
+	}
+	gaps := subtractRanges([]byteRange{{start: 0, end: file_size - 1}}, mergeRanges(done))
+	var remaining int64
+	for _, g := range gaps {
+		remaining += g.end - g.start + 1
+	}
+	var parts []part
+	for _, g := range gaps {
+		size := g.end - g.start + 1
+		n := count * size / remaining
+		if n < 1 {
+			n = 1
+		}
+		for _, p := range splitParts(size, n) {
+			parts = append(parts, part{num: int64(len(parts)), start: g.start + p.start, end: g.start + p.end})
+		}
+	}
+	return parts
+}
+
+// fileStore 为写入本地文件的 PartStore，开启续传时已完成的范围来自进度文件。
+type fileStore struct {
+	file       File
+	checkpoint *checkpoint
+}
+
+func (s *fileStore) WriteAt(p []byte, off int64) (int, error) {
+	return s.file.WriteAt(p, off)
+}
+
+func (s *fileStore) ReadAt(p []byte, off int64) (int, error) {
+	return s.file.ReadAt(p, off)
+}
+
+func (s *fileStore) Finalize() error {
+	return nil
+}
+
+func (s *fileStore) CompletedRanges() []Range {
+	if s.checkpoint == nil {
+		return nil
+	}
+	var ranges []Range
+	for i, p := range s.checkpoint.m.Parts {
+		if written := s.checkpoint.written[i].Load(); written > 0 {
+			ranges = append(ranges, Range{Start: p.Start, End: p.Start + written - 1})
+		}
+	}
+	return ranges
+}
+
+// writerAtStore 将 io.WriterAt 作为没有已完成范围的 PartStore 使用。
+type writerAtStore struct {
+	io.WriterAt
+}
+
+func (writerAtStore) Finalize() error { return nil }
+
+func (writerAtStore) CompletedRanges() []Range { return nil }
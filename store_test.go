@@ -0,0 +1,124 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// memStore 为保存在内存中的 PartStore。
+type memStore struct {
+	mu        sync.Mutex
+	data      []byte
+	completed []Range
+	finalized int
+}
+
+func (s *memStore) WriteAt(p []byte, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(s.data)) {
+		s.data = append(s.data, make([]byte, end-int64(len(s.data)))...)
+	}
+	return copy(s.data[off:], p), nil
+}
+
+func (s *memStore) Finalize() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finalized++
+	return nil
+}
+
+func (s *memStore) CompletedRanges() []Range {
+	return s.completed
+}
+
+func TestParallelDownloadToStore(t *testing.T) {
+	data := testContent(10000)
+	var mu sync.Mutex
+	var requested []string
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			requested = append(requested, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		serveData(data)(w, r)
+	}))
+
+	// 已经保存了开头与中间的一段
+	store := &memStore{
+		data:      make([]byte, len(data)),
+		completed: []Range{{Start: 0, End: 999}, {Start: 5000, End: 5999}},
+	}
+	copy(store.data[:1000], data)
+	copy(store.data[5000:6000], data[5000:])
+	res, err := ParallelDownloadToStore(s.URL+"/f.bin", store, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(store.data, data) {
+		t.Fatal("store content mismatch")
+	}
+	if store.finalized != 1 {
+		t.Fatalf("Finalize called %d times, want 1", store.finalized)
+	}
+	if res.Size != 8000 {
+		t.Fatalf("downloaded %d bytes, want only the 8000 missing", res.Size)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, rng := range requested {
+		var start, end int
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		if start <= 999 || start <= 5999 && end >= 5000 {
+			t.Errorf("completed range requested again: %s", rng)
+		}
+	}
+}
+
+func TestParallelDownloadToStoreContext(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	store := &memStore{}
+	_, err := ParallelDownloadToStoreContext(ctx, s.URL+"/f.bin", store, 4)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want ctx.Err()", err)
+	}
+	if store.finalized != 0 {
+		t.Fatal("Finalize called for a canceled download")
+	}
+
+	// 获取信息时取消，不回退到单线程下载
+	var gets atomic.Int32
+	probing := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		<-r.Context().Done()
+	}))
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = ParallelDownloadToStoreContext(ctx, probing.URL+"/f.bin", &memStore{}, 4)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want ctx.Err()", err)
+	}
+	// HEAD 之后可能还有 Range 探测，但不应有不带 Range 的单线程请求
+	if n := gets.Load(); n > 1 {
+		t.Fatalf("%d GET requests after the context ended", n)
+	}
+}
@@ -0,0 +1,97 @@
+package paralleldownload
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrSymlinkDestination 表示保存路径是符号链接，且设置了 SymlinkRefuse。
+var ErrSymlinkDestination = errors.New("destination is a symlink")
+
+// SymlinkPolicy 决定保存路径已经是符号链接时的处理方式。
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow 直接写入链接指向的文件(默认)。
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkRefuse 拒绝写入，返回 ErrSymlinkDestination。支持的系统上以 O_NOFOLLOW 打开文件。
+	SymlinkRefuse
+	// SymlinkWarn 解析链接目标并记录警告日志，然后写入目标文件。
+	SymlinkWarn
+)
+
+func (p SymlinkPolicy) String() string {
+	switch p {
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkRefuse:
+		return "refuse"
+	case SymlinkWarn:
+		return "warn"
+	}
+	return fmt.Sprintf("SymlinkPolicy(%d)", int(p))
+}
+
+// renameDest 将下载完成的 from 重命名为保存路径 to。to 是符号链接时按 symlinkPolicy 处理：
+// SymlinkFollow、SymlinkWarn 替换链接指向的文件，SymlinkRefuse 返回 ErrSymlinkDestination。
+// 使用 WithFS 时直接重命名。
+func (o *options) renameDest(from string, to string) error {
+	if o.fs != nil {
+		return o.fs.Rename(from, to)
+	}
+	if fi, err := os.Lstat(to); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if o.symlinkPolicy == SymlinkRefuse {
+			return fmt.Errorf("%w: %s", ErrSymlinkDestination, to)
+		}
+		target, err := filepath.EvalSymlinks(to)
+		if err != nil {
+			return err
+		}
+		if o.symlinkPolicy == SymlinkWarn {
+			o.logger.Warn("destination is a symlink", "path", to, "target", target)
+		}
+		to = target
+	}
+	return os.Rename(from, to)
+}
+
+// openDest 按 symlinkPolicy 打开保存文件，使用 WithFS 时由其打开。
+func (o *options) openDest(path string, flag int) (File, error) {
+	if o.fs != nil {
+		return o.fs.OpenFile(path, flag, 0666)
+	}
+	f, err := o.openLocal(path, flag)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (o *options) openLocal(path string, flag int) (*os.File, error) {
+	if o.symlinkPolicy == SymlinkFollow {
+		return os.OpenFile(path, flag, 0666)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if o.symlinkPolicy == SymlinkRefuse {
+			return nil, fmt.Errorf("%w: %s", ErrSymlinkDestination, path)
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			// 悬空链接，打开时会按链接内容创建目标文件
+			target, _ = os.Readlink(path)
+		}
+		o.logger.Warn("destination is a symlink", "path", path, "target", target)
+		return os.OpenFile(path, flag, 0666)
+	}
+	if o.symlinkPolicy == SymlinkRefuse {
+		// Lstat 与打开之间路径可能被替换为链接，由 O_NOFOLLOW 兜底
+		f, err := os.OpenFile(path, flag|oNoFollow, 0666)
+		if err != nil && isSymlinkLoop(err) {
+			return nil, fmt.Errorf("%w: %s", ErrSymlinkDestination, path)
+		}
+		return f, err
+	}
+	return os.OpenFile(path, flag, 0666)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package paralleldownload
+
+// 不支持 O_NOFOLLOW 的系统上只依赖打开前的 Lstat 检查。
+const oNoFollow = 0
+
+func isSymlinkLoop(err error) bool {
+	return false
+}
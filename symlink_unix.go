@@ -0,0 +1,15 @@
+//go:build unix
+
+package paralleldownload
+
+import (
+	"errors"
+	"syscall"
+)
+
+const oNoFollow = syscall.O_NOFOLLOW
+
+// isSymlinkLoop 判断是否因 O_NOFOLLOW 遇到符号链接而打开失败。
+func isSymlinkLoop(err error) bool {
+	return errors.Is(err, syscall.ELOOP)
+}
@@ -0,0 +1,72 @@
+//go:build unix
+
+package paralleldownload
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// symlinkDest 在 dir 中创建指向 target 的链接 f.bin，target 的内容为 "original"。
+func symlinkDest(t *testing.T) (dir string, target string) {
+	t.Helper()
+	dir = t.TempDir()
+	target = filepath.Join(t.TempDir(), "target")
+	if err := os.WriteFile(target, []byte("original"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, filepath.Join(dir, "f.bin")); err != nil {
+		t.Fatal(err)
+	}
+	return dir, target
+}
+
+func TestSymlinkRefuse(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, serveData(data))
+	for name, download := range map[string]func(dir string) error{
+		"parallel": func(dir string) error {
+			return ParallelDownload(s.URL+"/f.bin", dir, "", 4, WithSymlinkPolicy(SymlinkRefuse))
+		},
+		"single": func(dir string) error {
+			return Download(s.URL+"/f.bin", dir, "", WithSymlinkPolicy(SymlinkRefuse))
+		},
+	} {
+		dir, target := symlinkDest(t)
+		if err := download(dir); !errors.Is(err, ErrSymlinkDestination) {
+			t.Fatalf("%s: err = %v, want ErrSymlinkDestination", name, err)
+		}
+		checkFile(t, target, []byte("original"))
+	}
+}
+
+func TestSymlinkFollowAndWarn(t *testing.T) {
+	data := testContent(10000)
+	s := newServer(t, serveData(data))
+
+	dir, target := symlinkDest(t)
+	if err := ParallelDownload(s.URL+"/f.bin", dir, "", 4); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, target, data)
+
+	dir, target = symlinkDest(t)
+	logger := &recordLogger{}
+	if err := ParallelDownload(s.URL+"/f.bin", dir, "", 4, WithSymlinkPolicy(SymlinkWarn), WithLogger(logger)); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, target, data)
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warning, ok := logger.find("destination is a symlink")
+	if !ok || warning.level != "warn" || warning.attrs["target"] != resolved {
+		t.Fatalf("warning = %+v", warning)
+	}
+	if fi, err := os.Lstat(filepath.Join(dir, "f.bin")); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("link replaced: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package paralleldownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrTeeNeedsReaderAt 表示续传时 PartStore 没有实现 io.ReaderAt，无法将已完成的范围写入 tee。
+var ErrTeeNeedsReaderAt = errors.New("tee requires the store to implement io.ReaderAt when resuming")
+
+// maxTeeBuffer 为默认的乱序到达、等待写入 tee 的数据在内存中的最大字节数，超过后下载线程阻塞等待。
+const maxTeeBuffer = 8 << 20
+
+// orderedTee 将多线程乱序写入的数据按文件顺序写入 w。
+// 偏移正好是下一个待写字节的数据直接写入 w(w 较慢时由此阻塞下载)，
+// 其余的数据先缓存，缓存超过 limit 时阻塞写入的线程。
+type orderedTee struct {
+	w        io.Writer
+	limit    int64
+	mu       sync.Mutex
+	cond     *sync.Cond
+	next     int64
+	pending  map[int64][]byte
+	buffered int64
+	err      error
+	// 续传时已完成、不会再下载的范围，从 src 读取
+	src  io.ReaderAt
+	done []byteRange
+}
+
+func newOrderedTee(tees []io.Writer, limit int64) *orderedTee {
+	if len(tees) == 0 {
+		return nil
+	}
+	t := &orderedTee{w: io.MultiWriter(tees...), limit: limit, pending: make(map[int64][]byte)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// feedCompleted 从 dst 读取下载开始前已经完成的范围，dst 需要实现 io.ReaderAt。
+func (t *orderedTee) feedCompleted(dst PartStore) error {
+	completed := dst.CompletedRanges()
+	if len(completed) == 0 {
+		return nil
+	}
+	src, ok := dst.(io.ReaderAt)
+	if !ok {
+		return ErrTeeNeedsReaderAt
+	}
+	t.setCompleted(src, completed)
+	return nil
+}
+
+// setCompleted 设置下载开始前已经保存在 src 中的范围，并写出从当前位置开始连续的部分。
+func (t *orderedTee) setCompleted(src io.ReaderAt, completed []Range) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.src = src
+	t.done = nil
+	for _, r := range completed {
+		t.done = append(t.done, byteRange{start: r.Start, end: r.End})
+	}
+	t.done = mergeRanges(t.done)
+	t.drain()
+}
+
+// write 提交偏移 off 处的数据，已经写入 tee 的部分会被忽略。
+func (t *orderedTee) write(ctx context.Context, off int64, p []byte) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.err == nil && off > t.next && t.buffered+int64(len(p)) > t.limit {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.cond.Wait()
+	}
+	if t.err != nil {
+		return t.err
+	}
+	if end := off + int64(len(p)); end <= t.next {
+		return nil
+	} else if off < t.next {
+		p = p[t.next-off:]
+		off = t.next
+	}
+	if off > t.next {
+		if old, ok := t.pending[off]; ok {
+			t.buffered -= int64(len(old))
+		}
+		t.pending[off] = append([]byte(nil), p...)
+		t.buffered += int64(len(p))
+		return nil
+	}
+	t.emit(p)
+	t.drain()
+	t.cond.Broadcast()
+	return t.err
+}
+
+// emit 将从 t.next 开始的 p 写入 tee。
+func (t *orderedTee) emit(p []byte) {
+	if t.err != nil {
+		return
+	}
+	if _, err := t.w.Write(p); err != nil {
+		t.err = err
+		return
+	}
+	t.next += int64(len(p))
+}
+
+// drain 写出缓存及已完成范围中从 t.next 开始连续的数据。
+func (t *orderedTee) drain() {
+	for t.err == nil {
+		if r, ok := t.completedAt(t.next); ok {
+			n, err := io.Copy(t.w, io.NewSectionReader(t.src, t.next, r.end-t.next+1))
+			t.next += n
+			if err != nil {
+				t.err = err
+			}
+			continue
+		}
+		found := false
+		for off, p := range t.pending {
+			end := off + int64(len(p))
+			if end <= t.next {
+				delete(t.pending, off)
+				t.buffered -= int64(len(p))
+				continue
+			}
+			if off <= t.next {
+				delete(t.pending, off)
+				t.buffered -= int64(len(p))
+				t.emit(p[t.next-off:])
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+}
+
+func (t *orderedTee) completedAt(off int64) (byteRange, bool) {
+	for _, r := range t.done {
+		if r.start <= off && off <= r.end {
+			return r, true
+		}
+	}
+	return byteRange{}, false
+}
+
+// wake 唤醒等待的线程，使其检查 ctx 是否已经结束。
+func (t *orderedTee) wake() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// teeWriter 将从偏移 0 开始的顺序写入提交给 orderedTee。
+type teeWriter struct {
+	ctx    context.Context
+	t      *orderedTee
+	offset int64
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	if err := w.t.write(w.ctx, w.offset, p); err != nil {
+		return 0, fmt.Errorf("tee write error: %w", err)
+	}
+	w.offset += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,65 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+)
+
+// slowWriter 每次写入前等待 delay。
+type slowWriter struct {
+	bytes.Buffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Buffer.Write(p)
+}
+
+// errWriter 的写入总是失败。
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("upload failed")
+}
+
+func TestTee(t *testing.T) {
+	data := testContent(200000)
+	s := newServer(t, serveData(data))
+	var copy1 bytes.Buffer
+	hasher := sha256.New()
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 8, WithTee(&copy1), WithTee(hasher))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if !bytes.Equal(copy1.Bytes(), data) {
+		t.Fatalf("tee got %d bytes out of order or incomplete", copy1.Len())
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(hasher.Sum(nil), sum[:]) {
+		t.Fatal("second tee got different content")
+	}
+}
+
+func TestTeeBackpressure(t *testing.T) {
+	data := testContent(200000)
+	s := newServer(t, serveData(data))
+	// 缓存很小且 tee 很慢，下载线程需要等待 tee
+	slow := &slowWriter{delay: time.Millisecond}
+	res, err := ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 8, WithTee(slow), WithTeeBuffer(16<<10), WithBufferSize(4<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if !bytes.Equal(slow.Bytes(), data) {
+		t.Fatalf("slow tee got %d bytes out of order or incomplete", slow.Len())
+	}
+
+	_, err = ParallelDownloadEx(s.URL+"/f.bin", t.TempDir(), "", 8, WithTee(errWriter{}))
+	if err == nil {
+		t.Fatal("download succeeded although the tee failed")
+	}
+}
@@ -0,0 +1,115 @@
+package paralleldownload
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// pieceVerifier 按文件顺序接收数据，每凑满一个分块就计算摘要并与 WithPieceChecksums 提供的比较，
+// 不一致时重新下载该分块并写回，使损坏在下载过程中尽早被发现。
+type pieceVerifier struct {
+	ctx       context.Context
+	w         *worker
+	dst       io.WriterAt
+	size      int64
+	pieceSize int64
+	sums      []string
+	h         hash.Hash
+	index     int
+	filled    int64
+}
+
+func newPieceVerifier(ctx context.Context, w *worker, dst io.WriterAt, file_size int64, o *options) (*pieceVerifier, error) {
+	pieces := (file_size + o.pieceSize - 1) / o.pieceSize
+	if int64(len(o.pieceSums)) != pieces {
+		return nil, fmt.Errorf("got %d piece checksums, but file has %d pieces", len(o.pieceSums), pieces)
+	}
+	h, err := newHash(o.pieceAlgo)
+	if err != nil {
+		return nil, err
+	}
+	return &pieceVerifier{ctx: ctx, w: w, dst: dst, size: file_size, pieceSize: o.pieceSize, sums: o.pieceSums, h: h}, nil
+}
+
+// pieceRange 返回第 i 个分块的范围，end 包含在内。
+func (v *pieceVerifier) pieceRange(i int) (start int64, end int64) {
+	start = int64(i) * v.pieceSize
+	end = start + v.pieceSize - 1
+	if end >= v.size {
+		end = v.size - 1
+	}
+	return start, end
+}
+
+func (v *pieceVerifier) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 && v.index < len(v.sums) {
+		start, end := v.pieceRange(v.index)
+		chunk := p
+		if want := end - start + 1 - v.filled; int64(len(chunk)) > want {
+			chunk = chunk[:want]
+		}
+		v.h.Write(chunk)
+		v.filled += int64(len(chunk))
+		p = p[len(chunk):]
+		if v.filled == end-start+1 {
+			if err := v.check(); err != nil {
+				return 0, err
+			}
+			v.index++
+			v.filled = 0
+			v.h.Reset()
+		}
+	}
+	return n, nil
+}
+
+// check 比较当前分块的摘要，不一致时重新下载一次。
+func (v *pieceVerifier) check() error {
+	expected := strings.TrimSpace(v.sums[v.index])
+	actual := hex.EncodeToString(v.h.Sum(nil))
+	if strings.EqualFold(actual, expected) {
+		return nil
+	}
+	start, end := v.pieceRange(v.index)
+	v.w.opts.logger.Warn("piece checksum mismatch, refetching", "piece", v.index, "start", start, "end", end,
+		"expected", expected, "actual", actual)
+	data, err := v.refetch(start, end)
+	if err != nil {
+		return fmt.Errorf("piece %d refetch error: %w", v.index, err)
+	}
+	v.h.Reset()
+	v.h.Write(data)
+	if actual = hex.EncodeToString(v.h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: piece %d [%d, %d]: expected %s, actual %s", ErrChecksumMismatch, v.index, start, end, expected, actual)
+	}
+	if _, err := v.dst.WriteAt(data, start); err != nil {
+		return fmt.Errorf("piece %d write error: %w", v.index, err)
+	}
+	return nil
+}
+
+func (v *pieceVerifier) refetch(start int64, end int64) ([]byte, error) {
+	body, err := v.w.requestRange(v.ctx, v.w.opts.client, -1, start, end, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(v.w.opts.bodyReader(v.ctx, body))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, fmt.Errorf("%w: got %d of %d bytes", ErrSizeMismatch, len(data), end-start+1)
+	}
+	return data, nil
+}
+
+// done 判断是否所有分块都已校验。
+func (v *pieceVerifier) done() bool {
+	return v.index == len(v.sums)
+}
@@ -0,0 +1,82 @@
+package paralleldownload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pieceSums 返回 data 每 size 字节一块的 sha256。
+func pieceSums(data []byte, size int) []string {
+	var sums []string
+	for start := 0; start < len(data); start += size {
+		end := start + size
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha256.Sum256(data[start:end])
+		sums = append(sums, hex.EncodeToString(sum[:]))
+	}
+	return sums
+}
+
+// corruptingServer 前 corrupt 次请求第一个分块时返回损坏的数据。
+// 最后一个分片在第一个分块被重新请求之前不返回，late 记录是否等到超时才返回。
+func corruptingServer(t *testing.T, data []byte, corrupt int32) (url string, late *atomic.Bool) {
+	var firstPiece atomic.Int32
+	refetched := make(chan struct{})
+	late = &atomic.Bool{}
+	s := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Range") {
+		case "bytes=0-9999":
+			n := firstPiece.Add(1)
+			if n == 2 {
+				close(refetched)
+			}
+			if n <= corrupt {
+				bad := append([]byte(nil), data...)
+				bad[100] ^= 0xff
+				serveData(bad)(w, r)
+				return
+			}
+		case "bytes=30000-39999":
+			select {
+			case <-refetched:
+			case <-time.After(5 * time.Second):
+				late.Store(true)
+			}
+		}
+		serveData(data)(w, r)
+	}))
+	return s.URL + "/f.bin", late
+}
+
+func TestPieceChecksumsRefetchEarly(t *testing.T) {
+	data := testContent(40000)
+	url, late := corruptingServer(t, data, 1)
+	res, err := ParallelDownloadEx(url, t.TempDir(), "", 4, WithPieceChecksums("sha256", 10000, pieceSums(data, 10000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, res.Path, data)
+	if late.Load() {
+		t.Fatal("corrupt piece was not refetched before the download completed")
+	}
+}
+
+func TestPieceChecksumsPersistentCorruption(t *testing.T) {
+	data := testContent(40000)
+	url, _ := corruptingServer(t, data, 2)
+	_, err := ParallelDownloadEx(url, t.TempDir(), "", 4, WithPieceChecksums("sha256", 10000, pieceSums(data, 10000)))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("err = %v, want ErrChecksumMismatch", err)
+	}
+
+	if _, err := ParallelDownloadEx(url, t.TempDir(), "", 4, WithPieceChecksums("sha256", 10000, []string{"00"})); err == nil {
+		t.Fatal("wrong number of piece checksums accepted")
+	}
+}
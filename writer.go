@@ -0,0 +1,94 @@
+package paralleldownload
+
+import (
+	"context"
+	"io"
+)
+
+// ParallelDownloadToWriterAt 多线程下载 url 并写入 dst(如内存缓冲区或自定义的存储)，
+// WriteAt 会被多个线程并发调用。服务器不支持 Range 时从偏移 0 开始顺序写入。
+func ParallelDownloadToWriterAt(download_url string, dst io.WriterAt, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return parallelDownloadTo(context.Background(), download_url, dst, worker_count, opts)
+}
+
+// ParallelDownloadTo 与 ParallelDownloadToWriterAt 相同，线程数由 WithWorkers 设置，
+// ctx 取消时停止下载并返回 ctx.Err()。
+func ParallelDownloadTo(ctx context.Context, download_url string, dst io.WriterAt, opts ...Option) (*DownloadResult, error) {
+	return parallelDownloadTo(ctx, download_url, dst, 0, opts)
+}
+
+func parallelDownloadTo(ctx context.Context, download_url string, dst io.WriterAt, worker_count int64, opts []Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	err := canceledError(ctx, parallelTo(dctx, download_url, writerAtStore{dst}, worker_count, o))
+	return o.finish(download_url, err), err
+}
+
+// DownloadTo 单线程下载 url 并按顺序写入 dst，ctx 取消时停止下载并返回 ctx.Err()。
+// 设置了 WithChecksums 时在写入的同时计算摘要，不一致时返回 *ChecksumError，但数据已经写入 dst。
+func DownloadTo(ctx context.Context, download_url string, dst io.Writer, opts ...Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	var sums *checksumWriter
+	if len(o.checksums) > 0 {
+		var err error
+		if sums, err = newChecksumWriter(o.checksums); err != nil {
+			return nil, err
+		}
+		dst = io.MultiWriter(dst, sums)
+	}
+	err := canceledError(ctx, streamTo(dctx, download_url, dst, o))
+	if err == nil && sums != nil {
+		err = sums.verify()
+	}
+	return o.finish(download_url, err), err
+}
+
+// ParallelDownloadToWriter 多线程下载 url，并按文件顺序写入只支持顺序写入的 w(如 tar 解包、分块上传)。
+// 各分片仍并发下载，但只有当前写入位置的数据能直接写入 w，其余数据先缓存在内存中，
+// 缓存最多 8 MiB(可用 WithTeeBuffer 调整)，缓存满后领先的线程会等待，
+// 此时速度接近单线程。w 较慢时下载也会随之变慢，w 返回错误时下载失败。
+// 写入 w 的数据无法撤回，WithPieceChecksums 发现分片错误前数据可能已经写入 w。
+func ParallelDownloadToWriter(download_url string, w io.Writer, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return ParallelDownloadToWriterAt(download_url, discardWriterAt{}, worker_count, append(opts[:len(opts):len(opts)], WithTee(w))...)
+}
+
+// ParallelDownloadReader 多线程下载 url，返回按文件顺序读取数据的 io.ReadCloser，不落盘，
+// 缓存与速度的限制参见 ParallelDownloadToWriter。下载失败时 Read 返回该错误，
+// 提前 Close 会停止下载。ctx 取消时 Read 返回 ctx.Err()。
+func ParallelDownloadReader(ctx context.Context, download_url string, worker_count int64, opts ...Option) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	r := &downloadReader{PipeReader: pr, cancel: cancel, done: make(chan struct{})}
+	opts = append(opts[:len(opts):len(opts)], WithTee(pw))
+	go func() {
+		defer close(r.done)
+		_, err := parallelDownloadTo(ctx, download_url, discardWriterAt{}, worker_count, opts)
+		pw.CloseWithError(err)
+	}()
+	return r
+}
+
+type downloadReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Close 停止下载并等待所有线程退出。
+func (r *downloadReader) Close() error {
+	r.cancel()
+	r.PipeReader.Close()
+	<-r.done
+	return nil
+}
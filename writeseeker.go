@@ -0,0 +1,116 @@
+package paralleldownload
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// seekWriterQueue 为等待写入 io.WriteSeeker 的数据块个数上限。
+const seekWriterQueue = 64
+
+// ParallelDownloadToWriteSeeker 多线程下载 url 并写入只支持 Seek+Write 的 dst。
+// 各线程仍并发下载，但所有写入由单独的 goroutine 依次 Seek 再 Write，写入速度
+// 受单个 goroutine 限制且会频繁 Seek，吞吐低于直接支持 io.WriterAt 的目标(如 *os.File)。
+// 最多缓存 64 个待写入的数据块，写入过慢时下载线程会等待。
+func ParallelDownloadToWriteSeeker(download_url string, dst io.WriteSeeker, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	return ParallelDownloadToWriteSeekerContext(context.Background(), download_url, dst, worker_count, opts...)
+}
+
+// ParallelDownloadToWriteSeekerContext 与 ParallelDownloadToWriteSeeker 相同，ctx 取消时停止下载并返回 ctx.Err()。
+func ParallelDownloadToWriteSeekerContext(ctx context.Context, download_url string, dst io.WriteSeeker, worker_count int64, opts ...Option) (*DownloadResult, error) {
+	o := newOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	defer o.audit.close()
+	dctx, cancel := o.context(ctx)
+	defer cancel()
+	w := newSeekWriter(dst)
+	err := parallelTo(dctx, download_url, writerAtStore{w}, worker_count, o)
+	if cerr := w.close(); err == nil {
+		err = cerr
+	}
+	err = canceledError(ctx, err)
+	return o.finish(download_url, err), err
+}
+
+type seekWrite struct {
+	data []byte
+	off  int64
+}
+
+// seekWriter 实现 io.WriterAt，将并发的写入交给单个 goroutine 以 Seek+Write 完成。
+type seekWriter struct {
+	dst    io.WriteSeeker
+	writes chan seekWrite
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newSeekWriter(dst io.WriteSeeker) *seekWriter {
+	w := &seekWriter{
+		dst:    dst,
+		writes: make(chan seekWrite, seekWriterQueue),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *seekWriter) run() {
+	defer close(w.done)
+	pos := int64(-1)
+	for req := range w.writes {
+		if w.getErr() != nil {
+			continue
+		}
+		if pos != req.off {
+			if _, err := w.dst.Seek(req.off, io.SeekStart); err != nil {
+				w.setErr(err)
+				continue
+			}
+		}
+		n, err := w.dst.Write(req.data)
+		if err == nil && n != len(req.data) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			w.setErr(err)
+			continue
+		}
+		pos = req.off + int64(n)
+	}
+}
+
+// WriteAt 复制 p 后放入写入队列，之前的写入错误会在之后的调用中返回。
+func (w *seekWriter) WriteAt(p []byte, off int64) (int, error) {
+	if err := w.getErr(); err != nil {
+		return 0, err
+	}
+	w.writes <- seekWrite{data: append([]byte(nil), p...), off: off}
+	return len(p), nil
+}
+
+// close 等待队列中的数据全部写入，并返回写入中出现的错误。
+func (w *seekWriter) close() error {
+	close(w.writes)
+	<-w.done
+	return w.getErr()
+}
+
+func (w *seekWriter) getErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *seekWriter) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
@@ -0,0 +1,83 @@
+package paralleldownload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// seekBuffer 为只实现 io.WriteSeeker 的内存缓冲区。
+type seekBuffer struct {
+	data []byte
+	pos  int64
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + int64(len(p)); end > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, end-int64(len(b.data)))...)
+	}
+	n := copy(b.data[b.pos:], p)
+	b.pos += int64(n)
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart || offset < 0 {
+		return 0, errors.New("unsupported seek")
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+func TestParallelDownloadToWriteSeeker(t *testing.T) {
+	data := testContent(100000)
+	s := newServer(t, serveData(data))
+	var dst io.WriteSeeker = &seekBuffer{}
+	if _, ok := dst.(io.WriterAt); ok {
+		t.Fatal("seekBuffer must not implement io.WriterAt")
+	}
+	res, err := ParallelDownloadToWriteSeeker(s.URL+"/f.bin", dst, 8, WithBufferSize(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Parallel || res.Size != int64(len(data)) {
+		t.Fatalf("parallel = %v, size = %d", res.Parallel, res.Size)
+	}
+	if got := dst.(*seekBuffer).data; !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch, got %d bytes", len(got))
+	}
+}
+
+// failingSeeker 的 Write 总是失败。
+type failingSeeker struct{ seekBuffer }
+
+func (f *failingSeeker) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestParallelDownloadToWriteSeekerErrors(t *testing.T) {
+	data := testContent(100000)
+	s := newServer(t, serveData(data))
+	if _, err := ParallelDownloadToWriteSeeker(s.URL+"/f.bin", &failingSeeker{}, 4); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("err = %v, want the write error", err)
+	}
+
+	stuck := newServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			<-r.Context().Done()
+			return
+		}
+		serveData(data)(w, r)
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ParallelDownloadToWriteSeekerContext(ctx, stuck.URL+"/f.bin", &seekBuffer{}, 4)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want ctx.Err()", err)
+	}
+}